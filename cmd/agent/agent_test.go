@@ -73,9 +73,8 @@ func TestAgent(t *testing.T) {
 
 	var wg sync.WaitGroup
 	client := app.NewHTTPClient(settings)
-	wg.Add(3)
+	wg.Add(2)
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	go client.CollectAdditionalMetrics(ctx, &wg)
 	go client.CollectMetrics(ctx, &wg)
 	go client.SendMetrics(ctx, &wg)
 	cancel()
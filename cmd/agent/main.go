@@ -10,6 +10,7 @@ import (
 
 	"github.com/syols/go-devops/config"
 	"github.com/syols/go-devops/internal/app"
+	"github.com/syols/go-devops/internal/ingest"
 )
 
 // @Title Agent API
@@ -34,10 +35,13 @@ func main() {
 	client := app.NewHTTPClient(settings)
 	ctx, _ := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 
-	wg.Add(3)
-	go client.CollectAdditionalMetrics(ctx, &wg)
+	listener := ingest.NewListener(settings.Agent.Ingest, client.AddMetrics)
+
+	wg.Add(4)
 	go client.CollectMetrics(ctx, &wg)
 	go client.SendMetrics(ctx, &wg)
+	go listener.Run(ctx, &wg)
+	go client.Telemetry().Run(ctx, &wg)
 	wg.Wait()
 	log.Print("Done!")
 }
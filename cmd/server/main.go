@@ -1,11 +1,13 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"os"
 
 	"github.com/syols/go-devops/config"
 	"github.com/syols/go-devops/internal/app"
+	"github.com/syols/go-devops/internal/keyring"
 )
 
 // @Title Agent API
@@ -28,7 +30,28 @@ func main() {
 	log.Printf("Build date: %s", config.ReplaceNoneValue(buildDate))
 	log.Printf("Build commit: %s", config.ReplaceNoneValue(buildCommit))
 
+	if len(os.Args) > 1 && os.Args[1] == "keygen" {
+		keygen(os.Args[2:])
+		return
+	}
+
 	if server, err := app.NewServer(config.NewConfig()); err == nil {
 		server.Run()
 	}
 }
+
+// keygen generates new key pair into keys directory layout. Example: go run main.go keygen -dir cert/keys -bits 4096
+func keygen(args []string) {
+	flags := flag.NewFlagSet("keygen", flag.ExitOnError)
+	dir := flags.String("dir", "cert/keys", "keys directory of crypto_keys_dir, private keys are written to dir/private, public keys to dir/public")
+	bits := flags.Int("bits", 4096, "key size")
+	if err := flags.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+
+	keyID, err := keyring.Generate(*dir, *bits)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Generated key %s in %s", keyID, *dir)
+}
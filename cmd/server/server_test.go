@@ -2,16 +2,22 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/suite"
 	"github.com/syols/go-devops/config"
 	"github.com/syols/go-devops/internal/app"
+	"github.com/syols/go-devops/internal/auth"
+	"github.com/syols/go-devops/internal/handlers"
 	"github.com/syols/go-devops/internal/models"
 )
 
@@ -45,6 +51,13 @@ func (suite *MetricSuite) SetupTest() {
 			StoreInterval: time.Second * 10,
 		},
 	}
+	key := "signed_key"
+	suite.settings.Server.Tenants = []config.TenantConfig{
+		{ID: "team", Public: true},
+		{ID: "signed", Key: &key},
+		{ID: "strict", Key: &key, ReplayRequired: true},
+	}
+	suite.settings.Server.Derived = []config.DerivedConfig{{Name: "PollCountRate", Kind: "rate", Source: "PollCount"}}
 	suite.client = http.Client{Transport: &http.Transport{
 		MaxIdleConns:        10,
 		MaxIdleConnsPerHost: 10,
@@ -167,6 +180,282 @@ func (suite *MetricSuite) TestUpdateCounterJSON() {
 	}
 }
 
+func (suite *MetricSuite) TestUpdateCounterConcurrent() {
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				suite.Equal(http.StatusOK, suite.request(http.MethodPost, "/update/counter/concurrent/1", nil).StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+
+	uri := url.URL{Scheme: "http", Host: suite.settings.Address(), Path: "/value/counter/concurrent"}
+	response, err := suite.client.Get(uri.String())
+	suite.NoError(err)
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	suite.NoError(err)
+	suite.Equal("500", string(body), "concurrent increments are not lost")
+}
+
+func (suite *MetricSuite) TestTenants() {
+	mocks := map[string]int{
+		"/tenants/team/update/gauge/testTenant/2.5": http.StatusOK,
+		"/tenants/other/update/gauge/testTenant/1":  http.StatusForbidden,
+	}
+	for route, status := range mocks {
+		suite.Equal(status, suite.request(http.MethodPost, route, nil).StatusCode, route)
+	}
+
+	suite.Equal(http.StatusNotFound, suite.request(http.MethodGet, "/value/gauge/testTenant", nil).StatusCode)
+	suite.Equal(http.StatusOK, suite.request(http.MethodGet, "/tenants/team/value/gauge/testTenant", nil).StatusCode)
+
+	header := http.Header{handlers.TenantHeader: []string{"team"}}
+	suite.Equal(http.StatusOK, suite.request(http.MethodGet, "/value/gauge/testTenant", header).StatusCode)
+}
+
+func (suite *MetricSuite) TestDerivedReadOnly() {
+	suite.Equal(http.StatusBadRequest, suite.request(http.MethodPost, "/update/gauge/PollCountRate/1", nil).StatusCode)
+	suite.Equal(http.StatusNotFound, suite.request(http.MethodGet, "/value/gauge/PollCountRate", nil).StatusCode)
+}
+
+func (suite *MetricSuite) TestReplayRequired() {
+	key := "signed_key"
+	value := 1.0
+	metric := models.Metric{Name: "testReplay", MetricType: models.GaugeName, GaugeValue: &value}
+	metric.Hash = metric.CalculateHash(&key)
+	body, err := json.Marshal(metric)
+	suite.NoError(err)
+
+	for tenant, status := range map[string]int{"signed": http.StatusOK, "strict": http.StatusUnauthorized} {
+		uri := url.URL{Scheme: "http", Host: suite.settings.Address(), Path: "/tenants/" + tenant + "/update/"}
+		response, err := suite.client.Post(uri.String(), "application/json", bytes.NewReader(body))
+		suite.NoError(err)
+		suite.NoError(response.Body.Close())
+		suite.Equal(status, response.StatusCode, tenant)
+	}
+}
+
+func (suite *MetricSuite) TestSignedPathUpdate() {
+	route := "/tenants/signed/update/gauge/testReplay/1"
+	suite.Equal(http.StatusUnauthorized, suite.request(http.MethodPost, route, nil).StatusCode)
+
+	key := "signed_key"
+	nonce, err := auth.NewNonce()
+	suite.NoError(err)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	header := http.Header{
+		auth.TimestampHeader: []string{timestamp},
+		auth.NonceHeader:     []string{nonce},
+		auth.SignatureHeader: []string{auth.SignRequest(&key, timestamp, nonce, http.MethodPost, route, nil)},
+	}
+	suite.Equal(http.StatusOK, suite.request(http.MethodPost, route, header).StatusCode)
+}
+
+func (suite *MetricSuite) TestTenantReadAccess() {
+	route := "/tenants/signed/value/gauge/testTenant"
+	suite.Equal(http.StatusUnauthorized, suite.request(http.MethodGet, route, nil).StatusCode)
+
+	key := "signed_key"
+	nonce, err := auth.NewNonce()
+	suite.NoError(err)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	header := http.Header{
+		auth.TimestampHeader: []string{timestamp},
+		auth.NonceHeader:     []string{nonce},
+		auth.SignatureHeader: []string{auth.SignRequest(&key, timestamp, nonce, http.MethodGet, route, nil)},
+	}
+	suite.Equal(http.StatusNotFound, suite.request(http.MethodGet, route, header).StatusCode)
+
+	settings := suite.settings
+	settings.Server.Tenants = []config.TenantConfig{{ID: "private"}}
+	_, err = app.NewServer(settings)
+	suite.Error(err, "tenant without key is not public")
+}
+
+func (suite *MetricSuite) TestBodySignature() {
+	key := "signed_key"
+	value := 2.5
+	body, err := json.Marshal(models.Metric{Name: "signed", MetricType: models.GaugeName, GaugeValue: &value})
+	suite.NoError(err)
+
+	uri := url.URL{
+		Scheme: "http",
+		Host:   suite.settings.Address(),
+		Path:   "/tenants/signed/update/",
+	}
+
+	for hash, status := range map[string]int{models.Sign(body, &key): http.StatusOK, "wrong": http.StatusBadRequest} {
+		request, err := http.NewRequest(http.MethodPost, uri.String(), bytes.NewReader(body))
+		suite.NoError(err)
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set(models.HashHeader, hash)
+
+		response, err := suite.client.Do(request)
+		suite.NoError(err)
+		responseBytes, err := io.ReadAll(response.Body)
+		suite.NoError(err)
+		suite.NoError(response.Body.Close())
+
+		suite.Equal(status, response.StatusCode)
+		if status == http.StatusOK {
+			suite.Equal(models.Sign(responseBytes, &key), response.Header.Get(models.HashHeader))
+		}
+	}
+}
+
+func (suite *MetricSuite) TestUpdatesBatchRetry() {
+	uri := url.URL{
+		Scheme: "http",
+		Host:   suite.settings.Address(),
+		Path:   "/updates/",
+	}
+
+	// retry of the first batch gets response of the first attempt and is not applied again
+	for i, batchID := range []string{"first", "first", "second"} {
+		delta := uint64(2)
+		body, err := json.Marshal([]models.Metric{{Name: "retried", MetricType: models.CounterName, CounterValue: &delta}})
+		suite.NoError(err)
+
+		request, err := http.NewRequest(http.MethodPost, uri.String(), bytes.NewReader(body))
+		suite.NoError(err)
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set(models.BatchIDHeader, batchID)
+
+		response, err := suite.client.Do(request)
+		suite.NoError(err)
+
+		var accepted models.Metric
+		suite.NoError(json.NewDecoder(response.Body).Decode(&accepted))
+		suite.NoError(response.Body.Close())
+		suite.Equal([]uint64{2, 2, 4}[i], *accepted.CounterValue)
+	}
+}
+
+func (suite *MetricSuite) TestUpdatesBatchRetryFailed() {
+	suite.Equal(http.StatusOK, suite.request(http.MethodPost, "/update/gauge/mismatched/1", nil).StatusCode)
+	uri := url.URL{
+		Scheme: "http",
+		Host:   suite.settings.Address(),
+		Path:   "/updates/",
+	}
+
+	// failed batch is not applied partially, so its retry does not double leading counters
+	delta := uint64(2)
+	metrics := []models.Metric{
+		{Name: "leading", MetricType: models.CounterName, CounterValue: &delta},
+		{Name: "mismatched", MetricType: models.CounterName, CounterValue: &delta},
+	}
+	for _, batch := range [][]models.Metric{metrics, metrics, metrics[:1]} {
+		body, err := json.Marshal(batch)
+		suite.NoError(err)
+
+		request, err := http.NewRequest(http.MethodPost, uri.String(), bytes.NewReader(body))
+		suite.NoError(err)
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set(models.BatchIDHeader, strconv.Itoa(len(batch)))
+
+		response, err := suite.client.Do(request)
+		suite.NoError(err)
+		suite.NoError(response.Body.Close())
+		if len(batch) > 1 {
+			suite.Equal(http.StatusNotImplemented, response.StatusCode)
+		}
+	}
+
+	response, err := suite.client.Get(uri.ResolveReference(&url.URL{Path: "/value/counter/leading"}).String())
+	suite.NoError(err)
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	suite.NoError(err)
+	suite.Equal("2", string(body))
+}
+
+func (suite *MetricSuite) TestCompression() {
+	value := 1.5
+	body, err := json.Marshal(models.Metric{Name: "compressed", MetricType: models.GaugeName, GaugeValue: &value})
+	suite.NoError(err)
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	_, err = gz.Write(body)
+	suite.NoError(err)
+	suite.NoError(gz.Close())
+
+	uri := url.URL{
+		Scheme: "http",
+		Host:   suite.settings.Address(),
+		Path:   "/update/",
+	}
+	request, err := http.NewRequest(http.MethodPost, uri.String(), &compressed)
+	suite.NoError(err)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Content-Encoding", "gzip")
+	request.Header.Set("Accept-Encoding", "gzip")
+
+	response, err := suite.client.Do(request)
+	suite.NoError(err)
+	suite.Equal(http.StatusOK, response.StatusCode)
+	suite.Equal("gzip", response.Header.Get("Content-Encoding"))
+
+	reader, err := gzip.NewReader(response.Body)
+	suite.NoError(err)
+	var metric models.Metric
+	suite.NoError(json.NewDecoder(reader).Decode(&metric))
+	suite.NoError(response.Body.Close())
+	suite.Equal(value, *metric.GaugeValue)
+}
+
+func (suite *MetricSuite) TestDebug() {
+	suite.Equal(http.StatusNotFound, suite.request(http.MethodGet, "/debug/pprof/", nil).StatusCode, "pprof is off on main router")
+
+	settings := suite.settings
+	settings.Server.Address = config.Address{Host: "127.0.0.1", Port: suite.freePort()}
+	settings.Server.Debug.Address = &config.Address{Host: "127.0.0.1", Port: suite.freePort()}
+	server, err := app.NewServer(settings)
+	suite.NoError(err)
+	go server.Run()
+	time.Sleep(time.Second)
+
+	for _, route := range []string{"/debug/pprof/", "/debug/pprof/heap", "/debug/pprof/goroutine"} {
+		uri := url.URL{Scheme: "http", Host: settings.Server.Debug.Address.String(), Path: route}
+		response, err := suite.client.Get(uri.String())
+		suite.NoError(err)
+		suite.NoError(response.Body.Close())
+		suite.Equal(http.StatusOK, response.StatusCode, route)
+	}
+}
+
+func (suite *MetricSuite) freePort() uint16 {
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	suite.NoError(err)
+	defer list.Close()
+	return uint16(list.Addr().(*net.TCPAddr).Port)
+}
+
+func (suite *MetricSuite) request(method, route string, header http.Header) *http.Response {
+	uri := url.URL{
+		Scheme: "http",
+		Host:   suite.settings.Address(),
+		Path:   route,
+	}
+
+	request, err := http.NewRequest(method, uri.String(), nil)
+	suite.NoError(err)
+	for name, values := range header {
+		request.Header[name] = values
+	}
+
+	response, err := suite.client.Do(request)
+	suite.NoError(err)
+	suite.NoError(response.Body.Close())
+	return response
+}
+
 func (suite *MetricSuite) check(mock Mock) {
 	uri := url.URL{
 		Scheme: "http",
@@ -23,24 +23,201 @@ type Config struct {
 
 // ServerConfig Server config struct
 type ServerConfig struct {
-	Address Address `yaml:"address" json:"address"`
-	Key     *string `yaml:"key,omitempty" json:"key,omitempty"`
+	Address     Address           `yaml:"address" json:"address"`
+	Key         *string           `yaml:"key,omitempty" json:"key,omitempty"`
+	Webhooks    []WebhookConfig   `yaml:"webhooks,omitempty" json:"webhooks,omitempty"`
+	Derived     []DerivedConfig   `yaml:"derived,omitempty" json:"derived,omitempty"`
+	Tenants     []TenantConfig    `yaml:"tenants,omitempty" json:"tenants,omitempty"`
+	Tokens      []TokenConfig     `yaml:"tokens,omitempty" json:"tokens,omitempty"`
+	TokensFile  *string           `yaml:"tokens_file,omitempty" json:"tokens_file,omitempty"`
+	Debug       DebugConfig       `yaml:"debug" json:"debug"`
+	Replay      ReplayConfig      `yaml:"replay" json:"replay"`
+	Compression CompressionConfig `yaml:"compression" json:"compression"`
+	Statsd      StatsdConfig      `yaml:"statsd" json:"statsd"`
+}
+
+// StatsdConfig StatsD UDP listener config struct, listener is disabled without address
+type StatsdConfig struct {
+	Address       *string       `yaml:"address,omitempty" json:"address,omitempty"`
+	FlushInterval time.Duration `yaml:"flush_interval" json:"flush_interval"`
+	Tenant        string        `yaml:"tenant" json:"tenant"`
+}
+
+// CompressionConfig gzip compression config struct, zero level means default compression
+type CompressionConfig struct {
+	Disabled bool `yaml:"disabled" json:"disabled"`
+	Level    int  `yaml:"level" json:"level"`
+}
+
+// ReplayConfig Replay protection config struct, required applies to the default tenant
+type ReplayConfig struct {
+	Required  bool          `yaml:"required" json:"required"`
+	ClockSkew time.Duration `yaml:"clock_skew" json:"clock_skew"`
+}
+
+// DebugConfig Debug endpoints config struct, endpoints are served only on configured address
+type DebugConfig struct {
+	Disabled bool     `yaml:"disabled" json:"disabled"`
+	Address  *Address `yaml:"address,omitempty" json:"address,omitempty"`
+}
+
+// TokenConfig API token config struct, tenants lists private tenants readable with the token
+type TokenConfig struct {
+	Token   string   `yaml:"token" json:"token"`
+	Scopes  []string `yaml:"scopes" json:"scopes"`
+	Tenants []string `yaml:"tenants,omitempty" json:"tenants,omitempty"`
+}
+
+// TenantConfig Tenant config struct, tenant without key must be explicitly public.
+// Replay required rejects unsigned writes of the tenant
+type TenantConfig struct {
+	ID             string  `yaml:"id" json:"id"`
+	Key            *string `yaml:"key,omitempty" json:"key,omitempty"`
+	Public         bool    `yaml:"public" json:"public"`
+	ReplayRequired bool    `yaml:"replay_required" json:"replay_required"`
+}
+
+// WebhookConfig Webhook config struct
+type WebhookConfig struct {
+	URL            string        `yaml:"url" json:"url"`
+	Pattern        string        `yaml:"pattern" json:"pattern"`
+	CounterDelta   uint64        `yaml:"counter_delta" json:"counter_delta"`
+	Key            *string       `yaml:"key,omitempty" json:"key,omitempty"`
+	Retries        int           `yaml:"retries" json:"retries"`
+	Backoff        time.Duration `yaml:"backoff" json:"backoff"`
+	Timeout        time.Duration `yaml:"timeout" json:"timeout"`
+	DeadLetterFile *string       `yaml:"dead_letter_file,omitempty" json:"dead_letter_file,omitempty"`
+}
+
+// DerivedConfig Derived metric config struct
+type DerivedConfig struct {
+	Name       string `yaml:"name" json:"name"`
+	Kind       string `yaml:"kind" json:"kind"`
+	Source     string `yaml:"source,omitempty" json:"source,omitempty"`
+	Window     int    `yaml:"window,omitempty" json:"window,omitempty"`
+	Expression string `yaml:"expression,omitempty" json:"expression,omitempty"`
 }
 
 // AgentConfig Agent config struct
 type AgentConfig struct {
-	PollInterval   time.Duration `yaml:"poll_interval" json:"poll_interval"`
-	ReportInterval time.Duration `yaml:"report_interval" json:"report_interval"`
-	ClientTimeout  time.Duration `yaml:"client_timeout" json:"client_timeout"`
+	PollInterval   time.Duration       `yaml:"poll_interval" json:"poll_interval"`
+	ReportInterval time.Duration       `yaml:"report_interval" json:"report_interval"`
+	ClientTimeout  time.Duration       `yaml:"client_timeout" json:"client_timeout"`
+	Tenant         *string             `yaml:"tenant,omitempty" json:"tenant,omitempty"`
+	Token          *string             `yaml:"token,omitempty" json:"token,omitempty"`
+	BodySignature  bool                `yaml:"body_signature" json:"body_signature"`
+	Queue          QueueConfig         `yaml:"queue" json:"queue"`
+	RateLimit      int                 `yaml:"rate_limit" json:"rate_limit"`
+	Compression    CompressionConfig   `yaml:"compression" json:"compression"`
+	Collectors     CollectorsConfig    `yaml:"collectors,omitempty" json:"collectors,omitempty"`
+	Disk           DiskConfig          `yaml:"disk" json:"disk"`
+	Network        NetworkConfig       `yaml:"network" json:"network"`
+	Processes      []ProcessConfig     `yaml:"processes,omitempty" json:"processes,omitempty"`
+	Ingest         IngestConfig        `yaml:"ingest" json:"ingest"`
+	Exec           []ExecConfig        `yaml:"exec,omitempty" json:"exec,omitempty"`
+	Scrape         []ScrapeConfig      `yaml:"scrape,omitempty" json:"scrape,omitempty"`
+	Telemetry      TelemetryConfig     `yaml:"telemetry" json:"telemetry"`
+	Aggregations   []AggregationConfig `yaml:"aggregations,omitempty" json:"aggregations,omitempty"`
+}
+
+// AggregationConfig Agent aggregation of gauges over report window, the first rule matching gauge name applies.
+// Functions are last, min, max, avg, p95, every function by default
+type AggregationConfig struct {
+	Pattern   string   `yaml:"pattern" json:"pattern"`
+	Functions []string `yaml:"functions,omitempty" json:"functions,omitempty"`
+}
+
+// TelemetryConfig Agent health endpoints config struct, endpoints are disabled without address
+type TelemetryConfig struct {
+	Address    *string       `yaml:"address,omitempty" json:"address,omitempty"`
+	StaleAfter time.Duration `yaml:"stale_after" json:"stale_after"`
+}
+
+// ScrapeConfig Agent scrape collector target in Prometheus text format, name prefixes target metrics
+type ScrapeConfig struct {
+	Name    string        `yaml:"name" json:"name"`
+	URL     string        `yaml:"url" json:"url"`
+	Timeout time.Duration `yaml:"timeout" json:"timeout"`
+	Metrics FilterConfig  `yaml:"metrics" json:"metrics"`
+}
+
+// ExecConfig Agent exec collector entry, executable prints metrics to stdout.
+// Zero interval runs executable every exec collector poll
+type ExecConfig struct {
+	Name     string        `yaml:"name" json:"name"`
+	Command  string        `yaml:"command" json:"command"`
+	Args     []string      `yaml:"args,omitempty" json:"args,omitempty"`
+	Interval time.Duration `yaml:"interval" json:"interval"`
+	Timeout  time.Duration `yaml:"timeout" json:"timeout"`
+}
+
+// IngestConfig Agent local ingestion listeners config struct, listener is disabled without address
+type IngestConfig struct {
+	StatsdAddress *string `yaml:"statsd_address,omitempty" json:"statsd_address,omitempty"`
+	HTTPAddress   *string `yaml:"http_address,omitempty" json:"http_address,omitempty"`
+}
+
+// DiskConfig Agent disk collector config struct
+type DiskConfig struct {
+	Mounts  FilterConfig `yaml:"mounts" json:"mounts"`
+	Devices FilterConfig `yaml:"devices" json:"devices"`
+}
+
+// NetworkConfig Agent network collector config struct
+type NetworkConfig struct {
+	Interfaces         FilterConfig `yaml:"interfaces" json:"interfaces"`
+	DisableConnections bool         `yaml:"disable_connections" json:"disable_connections"`
+}
+
+// ProcessConfig Agent process collector entry, exactly one of process name, pidfile or cmdline regular expression
+type ProcessConfig struct {
+	Name        string `yaml:"name" json:"name"`
+	ProcessName string `yaml:"process_name,omitempty" json:"process_name,omitempty"`
+	Pidfile     string `yaml:"pidfile,omitempty" json:"pidfile,omitempty"`
+	Cmdline     string `yaml:"cmdline,omitempty" json:"cmdline,omitempty"`
+}
+
+// FilterConfig include and exclude regular expressions, empty include matches everything
+type FilterConfig struct {
+	Include []string `yaml:"include,omitempty" json:"include,omitempty"`
+	Exclude []string `yaml:"exclude,omitempty" json:"exclude,omitempty"`
+}
+
+// CollectorsConfig Agent collectors config by collector name
+type CollectorsConfig map[string]CollectorConfig
+
+// CollectorConfig Agent collector config struct, zero poll interval means agent poll interval
+type CollectorConfig struct {
+	Disabled     bool          `yaml:"disabled" json:"disabled"`
+	PollInterval time.Duration `yaml:"poll_interval" json:"poll_interval"`
+}
+
+// QueueConfig Agent outgoing queue config struct
+type QueueConfig struct {
+	Size       int           `yaml:"size" json:"size"`
+	File       *string       `yaml:"file,omitempty" json:"file,omitempty"`
+	MinBackoff time.Duration `yaml:"min_backoff" json:"min_backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff" json:"max_backoff"`
 }
 
 // StoreConfig Store config struct
 type StoreConfig struct {
 	CryptoKeyFilePath        *string
+	CryptoKeysDir            *string       `yaml:"crypto_keys_dir,omitempty" json:"crypto_keys_dir,omitempty"`
 	DatabaseConnectionString *string       `yaml:"database,omitempty" json:"database,omitempty"`
 	StoreFile                *string       `yaml:"store_file,omitempty" json:"store_file,omitempty"`
 	Restore                  bool          `yaml:"restore" json:"restore"`
 	StoreInterval            time.Duration `yaml:"store_interval" json:"store_interval"`
+	History                  HistoryConfig `yaml:"history" json:"history"`
+}
+
+// HistoryConfig History config struct
+type HistoryConfig struct {
+	Enabled         bool          `yaml:"enabled" json:"enabled"`
+	RollupInterval  time.Duration `yaml:"rollup_interval" json:"rollup_interval"`
+	RawRetention    time.Duration `yaml:"raw_retention" json:"raw_retention"`
+	MinuteRetention time.Duration `yaml:"minute_retention" json:"minute_retention"`
+	HourRetention   time.Duration `yaml:"hour_retention" json:"hour_retention"`
 }
 
 // Address struct
@@ -66,7 +243,12 @@ func (s *Config) LoadFromEnvironment() {
 
 // Address create HTTP address
 func (s *Config) Address() string {
-	return fmt.Sprintf("%s:%d", s.Server.Address.Host, s.Server.Address.Port)
+	return s.Server.Address.String()
+}
+
+// String create HTTP address
+func (a Address) String() string {
+	return fmt.Sprintf("%s:%d", a.Host, a.Port)
 }
 
 // String create string from config
@@ -97,15 +279,49 @@ func (s *Config) setDefault(configPath string) error {
 
 func withAddress(address string) Option {
 	return func(s *Config) {
-		if host, port, err := net.SplitHostPort(address); err == nil {
-			if port, err := strconv.ParseUint(port, 0, 16); err == nil {
-				s.Server.Address.Host = host
-				s.Server.Address.Port = uint16(port)
-			}
+		if value, err := parseAddress(address); err == nil {
+			s.Server.Address = value
+		}
+	}
+}
+
+func withDebugAddress(address string) Option {
+	return func(s *Config) {
+		if value, err := parseAddress(address); err == nil {
+			s.Server.Debug.Address = &value
+		}
+	}
+}
+
+func withDebugDisabled(value string) Option {
+	return func(s *Config) {
+		if val, err := strconv.ParseBool(value); err == nil {
+			s.Server.Debug.Disabled = val
+		}
+	}
+}
+
+func withBodySignature(value string) Option {
+	return func(s *Config) {
+		if val, err := strconv.ParseBool(value); err == nil {
+			s.Agent.BodySignature = val
 		}
 	}
 }
 
+func parseAddress(address string) (Address, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return Address{}, err
+	}
+
+	value, err := strconv.ParseUint(port, 0, 16)
+	if err != nil {
+		return Address{}, err
+	}
+	return Address{Host: host, Port: uint16(value)}, nil
+}
+
 func withStoreFile(value string) Option {
 	return func(s *Config) {
 		s.Store.StoreFile = &value
@@ -160,6 +376,85 @@ func withKey(value string) Option {
 	}
 }
 
+func withTenant(value string) Option {
+	return func(s *Config) {
+		s.Agent.Tenant = &value
+	}
+}
+
+func withToken(value string) Option {
+	return func(s *Config) {
+		s.Agent.Token = &value
+	}
+}
+
+func withTokensFile(value string) Option {
+	return func(s *Config) {
+		s.Server.TokensFile = &value
+	}
+}
+
+func withCompressionLevel(value string) Option {
+	return func(s *Config) {
+		if val, err := strconv.Atoi(value); err == nil {
+			s.Server.Compression.Level = val
+			s.Agent.Compression.Level = val
+		}
+	}
+}
+
+func withRateLimit(value string) Option {
+	return func(s *Config) {
+		if val, err := strconv.Atoi(value); err == nil {
+			s.Agent.RateLimit = val
+		}
+	}
+}
+
+func withStatsdAddress(value string) Option {
+	return func(s *Config) {
+		s.Server.Statsd.Address = &value
+	}
+}
+
+func withStatsdFlushInterval(value string) Option {
+	return func(s *Config) {
+		if val, err := time.ParseDuration(value); err == nil {
+			s.Server.Statsd.FlushInterval = val
+		}
+	}
+}
+
+func withTelemetryAddress(value string) Option {
+	return func(s *Config) {
+		s.Agent.Telemetry.Address = &value
+	}
+}
+
+func withIngestStatsd(value string) Option {
+	return func(s *Config) {
+		s.Agent.Ingest.StatsdAddress = &value
+	}
+}
+
+func withIngestHTTP(value string) Option {
+	return func(s *Config) {
+		s.Agent.Ingest.HTTPAddress = &value
+	}
+}
+
+func withQueueFile(value string) Option {
+	return func(s *Config) {
+		s.Agent.Queue.File = &value
+	}
+}
+
+func withCryptoKeysDir(value string) Option {
+	return func(s *Config) {
+		s.Store.CryptoKeysDir = &value
+	}
+}
+
 func withDatabase(value string) Option {
 	return func(s *Config) {
 		s.Store.DatabaseConnectionString = &value
@@ -18,16 +18,31 @@ type EnvironmentVariables map[Variable]func(string) Option
 // NewEnvironmentVariables creates EnvironmentVariables struct
 func NewEnvironmentVariables() EnvironmentVariables {
 	return EnvironmentVariables{
-		newVariable("ADDRESS", "a"):             withAddress,
-		newVariable("REPORT_INTERVAL", "ri"):    withReportInterval,
-		newVariable("POLL_INTERVAL", "p"):       withPollInterval,
-		newVariable("CLIENT_TIMEOUT", "c"):      withClientTimeout,
-		newVariable("STORE_INTERVAL", "i"):      withStoreInterval,
-		newVariable("RESTORE", "r"):             withRestore,
-		newVariable("KEY", "k"):                 withKey,
-		newVariable("STORE_FILE", "f"):          withStoreFile,
-		newVariable("DATABASE_DSN", "d"):        withDatabase,
-		newVariable("CRYPTO_KEY", "crypto-key"): withCryptoKey,
+		newVariable("ADDRESS", "a"):                withAddress,
+		newVariable("REPORT_INTERVAL", "ri"):       withReportInterval,
+		newVariable("POLL_INTERVAL", "p"):          withPollInterval,
+		newVariable("CLIENT_TIMEOUT", "c"):         withClientTimeout,
+		newVariable("STORE_INTERVAL", "i"):         withStoreInterval,
+		newVariable("RESTORE", "r"):                withRestore,
+		newVariable("KEY", "k"):                    withKey,
+		newVariable("STORE_FILE", "f"):             withStoreFile,
+		newVariable("DATABASE_DSN", "d"):           withDatabase,
+		newVariable("CRYPTO_KEY", "crypto-key"):    withCryptoKey,
+		newVariable("CRYPTO_KEYS_DIR", "ckd"):      withCryptoKeysDir,
+		newVariable("TENANT", "t"):                 withTenant,
+		newVariable("TOKEN", "token"):              withToken,
+		newVariable("TOKENS_FILE", "tokens"):       withTokensFile,
+		newVariable("DEBUG_ADDRESS", "da"):         withDebugAddress,
+		newVariable("DEBUG_DISABLED", "dd"):        withDebugDisabled,
+		newVariable("BODY_SIGNATURE", "bs"):        withBodySignature,
+		newVariable("QUEUE_FILE", "qf"):            withQueueFile,
+		newVariable("RATE_LIMIT", "l"):             withRateLimit,
+		newVariable("COMPRESSION_LEVEL", "cl"):     withCompressionLevel,
+		newVariable("STATSD_ADDRESS", "sa"):        withStatsdAddress,
+		newVariable("STATSD_FLUSH_INTERVAL", "sf"): withStatsdFlushInterval,
+		newVariable("INGEST_STATSD", "is"):         withIngestStatsd,
+		newVariable("TELEMETRY_ADDRESS", "ta"):     withTelemetryAddress,
+		newVariable("INGEST_HTTP", "ih"):           withIngestHTTP,
 	}
 }
 
@@ -0,0 +1,100 @@
+package app
+
+import (
+	"log"
+	"math"
+	"regexp"
+	"sort"
+
+	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/models"
+)
+
+// Aggregation functions over report window, last is sent with the original metric name
+const (
+	aggregateLast = "last"
+	aggregateMin  = "min"
+	aggregateMax  = "max"
+	aggregateAvg  = "avg"
+	aggregateP95  = "p95"
+)
+
+var defaultAggregateFunctions = []string{aggregateLast, aggregateMin, aggregateMax, aggregateAvg, aggregateP95}
+
+// aggregation of gauges matching pattern
+type aggregation struct {
+	pattern   *regexp.Regexp
+	functions []string
+	last      bool
+}
+
+// newAggregations compiles aggregation rules, invalid rules are logged and skipped
+func newAggregations(settings []config.AggregationConfig) []aggregation {
+	var result []aggregation
+	for _, entry := range settings {
+		pattern, err := regexp.Compile(entry.Pattern)
+		if err != nil {
+			log.Printf("aggregation %s: %s", entry.Pattern, err.Error())
+			continue
+		}
+
+		functions := entry.Functions
+		if len(functions) == 0 {
+			functions = defaultAggregateFunctions
+		}
+
+		rule := aggregation{pattern: pattern}
+		for _, function := range functions {
+			switch function {
+			case aggregateLast:
+				rule.last = true
+			case aggregateMin, aggregateMax, aggregateAvg, aggregateP95:
+				rule.functions = append(rule.functions, function)
+			default:
+				log.Printf("aggregation %s: unknown function %s", entry.Pattern, function)
+			}
+		}
+		result = append(result, rule)
+	}
+	return result
+}
+
+// findAggregation returns the first rule matching gauge name
+func findAggregation(rules []aggregation, name string) (aggregation, bool) {
+	for _, rule := range rules {
+		if rule.pattern.MatchString(name) {
+			return rule, true
+		}
+	}
+	return aggregation{}, false
+}
+
+// aggregate samples of report window to gauges suffixed by function name, e.g. CPUutilization0_max
+func (a aggregation) aggregate(name string, samples []float64) []models.Metric {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	sorted := append([]float64(nil), samples...)
+	sort.Float64s(sorted)
+
+	result := make([]models.Metric, 0, len(a.functions))
+	for _, function := range a.functions {
+		var value float64
+		switch function {
+		case aggregateMin:
+			value = sorted[0]
+		case aggregateMax:
+			value = sorted[len(sorted)-1]
+		case aggregateAvg:
+			for _, sample := range sorted {
+				value += sample
+			}
+			value /= float64(len(sorted))
+		case aggregateP95:
+			value = sorted[int(math.Ceil(0.95*float64(len(sorted))))-1]
+		}
+		result = append(result, models.Gauge(name+"_"+function, value))
+	}
+	return result
+}
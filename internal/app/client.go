@@ -2,41 +2,56 @@ package app
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/hmac"
 	cryprorand "crypto/rand"
 	"crypto/rsa"
 	"crypto/sha512"
-	"crypto/x509"
 	"encoding/json"
-	"encoding/pem"
+	"errors"
 	"fmt"
+	"io"
 	"log"
-	"math/rand"
 	"net/http"
 	"net/url"
-	"os"
-	"runtime"
+	"path"
+	"strconv"
 	"sync"
 	"time"
 
-	"github.com/shirou/gopsutil/v3/cpu"
-	"github.com/shirou/gopsutil/v3/mem"
-
 	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/auth"
+	"github.com/syols/go-devops/internal/collector"
+	"github.com/syols/go-devops/internal/keyring"
 	"github.com/syols/go-devops/internal/models"
+	"github.com/syols/go-devops/internal/queue"
+	"github.com/syols/go-devops/internal/telemetry"
 )
 
 // Client struct
 type Client struct {
 	metrics        map[string]float64
 	key            *string
+	token          *string
+	bodySignature  bool
 	Client         http.Client
 	url            string
-	count          uint64
+	counters       map[string]uint64
+	collectors     []collector.Scheduled
 	pollInterval   time.Duration
 	reportInterval time.Duration
 	mutex          sync.RWMutex
 	publicKey      *rsa.PublicKey
+	keyID          string
+	queue          *queue.Queue
+	minBackoff     time.Duration
+	maxBackoff     time.Duration
+	rateLimit      int
+	compression    config.CompressionConfig
+	telemetry      *telemetry.Telemetry
+	aggregations   []aggregation
+	samples        map[string][]float64
 }
 
 // NewHTTPClient creates new HTTP client struct
@@ -45,35 +60,90 @@ func NewHTTPClient(settings config.Config) Client {
 		MaxIdleConns:        40,
 		MaxIdleConnsPerHost: 40,
 	}
-	client := http.Client{Transport: transport}
+	client := http.Client{Transport: transport, Timeout: settings.Agent.ClientTimeout}
 
 	uri := url.URL{
 		Scheme: "http",
 		Host:   settings.Address(),
 		Path:   "/updates/",
 	}
+	if settings.Agent.Tenant != nil {
+		uri.Path = path.Join("/tenants", *settings.Agent.Tenant, uri.Path) + "/"
+	}
 
 	var publicKey *rsa.PublicKey
+	var keyID string
 	if settings.Store.CryptoKeyFilePath != nil {
-		byteArr, err := os.ReadFile(*settings.Store.CryptoKeyFilePath) // just pass the file name
+		key, err := keyring.LoadPublicKey(*settings.Store.CryptoKeyFilePath)
 		if err != nil {
-			fmt.Print(err)
+			log.Print(err)
+		} else {
+			publicKey = key
+			keyID, _ = keyring.PublicKeyID(*settings.Store.CryptoKeyFilePath)
 		}
+	}
 
-		if blocks, err := pem.Decode(byteArr); err == nil {
-			pubInterface, _ := x509.ParsePKIXPublicKey(blocks.Bytes)
-			publicKey = pubInterface.(*rsa.PublicKey)
-		}
+	rateLimit := settings.Agent.RateLimit
+	if rateLimit <= 0 {
+		rateLimit = 1
 	}
 
+	outgoing := queue.NewQueue(settings.Agent.Queue)
+	if err := outgoing.Restore(); err != nil {
+		log.Print(err)
+	}
+
+	agentTelemetry := telemetry.NewTelemetry(settings.Agent)
+	agentTelemetry.GaugeFunc(telemetry.QueueDepth, func() float64 {
+		return float64(outgoing.Len())
+	})
+
+	registry := collector.NewRegistry()
+	registry.Register(telemetry.Name, func(config.Config) (collector.Collector, error) {
+		return agentTelemetry, nil
+	})
+
 	return Client{
 		Client:         client,
 		metrics:        map[string]float64{},
+		counters:       map[string]uint64{},
+		collectors:     registry.Build(settings),
 		url:            uri.String(),
 		key:            settings.Server.Key,
+		token:          settings.Agent.Token,
+		bodySignature:  settings.Agent.BodySignature,
 		pollInterval:   settings.Agent.PollInterval,
 		reportInterval: settings.Agent.ReportInterval,
 		publicKey:      publicKey,
+		keyID:          keyID,
+		queue:          outgoing,
+		minBackoff:     settings.Agent.Queue.MinBackoff,
+		maxBackoff:     settings.Agent.Queue.MaxBackoff,
+		rateLimit:      rateLimit,
+		compression:    settings.Agent.Compression,
+		telemetry:      agentTelemetry,
+		aggregations:   newAggregations(settings.Agent.Aggregations),
+		samples:        map[string][]float64{},
+	}
+}
+
+// Telemetry returns agent self metrics
+func (c *Client) Telemetry() *telemetry.Telemetry {
+	return c.telemetry
+}
+
+// AddMetrics adds collected metrics, gauges are replaced and counter deltas are summed
+func (c *Client) AddMetrics(metrics []models.Metric) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, metric := range metrics {
+		switch {
+		case metric.MetricType == models.GaugeName && metric.GaugeValue != nil:
+			c.setGauge(metric.Name, *metric.GaugeValue)
+		case metric.MetricType == models.CounterName && metric.CounterValue != nil:
+			c.counters[metric.Name] += *metric.CounterValue
+		}
 	}
 }
 
@@ -83,135 +153,372 @@ func (c *Client) SetMetrics(metrics map[string]float64) {
 	defer c.mutex.Unlock()
 
 	for name := range metrics {
-		c.metrics[name] = metrics[name]
+		c.setGauge(name, metrics[name])
+	}
+}
+
+// setGauge replaces gauge value and keeps sample of aggregated gauge, caller holds mutex
+func (c *Client) setGauge(name string, value float64) {
+	c.metrics[name] = value
+	if _, isOk := findAggregation(c.aggregations, name); isOk {
+		c.samples[name] = append(c.samples[name], value)
 	}
 }
 
-// SendMetrics send metric to HTTP server
+// SendMetrics queues metrics on each report tick and dispatches them to RateLimit send workers,
+// failed batches are retried unchanged with the same batch ID and backoff
 func (c *Client) SendMetrics(ctx context.Context, wg *sync.WaitGroup) {
 	defer wg.Done()
 	reportInterval := time.NewTicker(c.reportInterval)
+	defer reportInterval.Stop()
+
+	retry := time.NewTimer(time.Hour) // armed only after failed send
+	retry.Stop()
+	defer retry.Stop()
+
+	jobs := make(chan batch)
+	results := make(chan sendResult, c.rateLimit)
+	for i := 0; i < c.rateLimit; i++ {
+		go c.worker(ctx, jobs, results)
+	}
+
+	state := sendState{retry: retry}
 	for {
 		select {
 		case <-reportInterval.C:
-			func() {
-				log.Println("SendMetrics")
-				var result []models.Metric
-				c.mutex.RLock()
-				defer c.mutex.RUnlock()
-				for name, value := range c.metrics {
-					v := value
-					metric := models.Metric{
-						Name:       name,
-						MetricType: models.GaugeName,
-						GaugeValue: &v,
-					}
-					metric.Hash = metric.CalculateHash(c.key)
-					result = append(result, metric)
-				}
-
-				c.count++
-				pollCount := models.Metric{Name: "PollCount", CounterValue: &c.count, MetricType: models.CounterName}
-				pollCount.Hash = pollCount.CalculateHash(c.key)
-				result = append(result, pollCount)
-				err := c.send(result)
-				if err != nil {
-					log.Print(err)
-				}
-			}()
+			log.Println("SendMetrics")
+			c.telemetry.Add(telemetry.DroppedMetrics, uint64(c.queue.Push(c.collect()...)))
+			if state.attempt == 0 {
+				c.dispatch(jobs, &state)
+			}
+		case <-retry.C:
+			state.armed = false
+			c.dispatch(jobs, &state)
+		case result := <-results:
+			state.inFlight--
+			c.handle(result, &state)
 		case <-ctx.Done():
+			close(jobs)
+			for ; state.inFlight > 0; state.inFlight-- {
+				c.handle(<-results, &state)
+			}
+			if err := c.queue.Spill(state.pendingMetrics()...); err != nil {
+				log.Print(err)
+			}
 			return
 		}
 	}
 }
 
-func (c *Client) send(metric []models.Metric) error {
-	requestBytes, err := json.Marshal(metric)
+// batch of metrics sent in one request, retries of the batch keep its ID
+type batch struct {
+	id      string
+	metrics []models.Metric
+}
+
+// sendResult result of batch sent by worker
+type sendResult struct {
+	batch batch
+	err   error
+}
+
+// sendState dispatcher state, owned by SendMetrics goroutine
+type sendState struct {
+	retry    *time.Timer
+	attempt  int
+	armed    bool
+	inFlight int
+	pending  []batch
+}
+
+// pendingMetrics metrics of failed batches waiting for retry
+func (s *sendState) pendingMetrics() []models.Metric {
+	var result []models.Metric
+	for _, pending := range s.pending {
+		result = append(result, pending.metrics...)
+	}
+	return result
+}
+
+// worker sends batches from jobs channel until it is closed
+func (c *Client) worker(ctx context.Context, jobs <-chan batch, results chan<- sendResult) {
+	for job := range jobs {
+		started := time.Now()
+		err := c.send(ctx, job)
+		c.telemetry.Observe(telemetry.SendLatency, time.Since(started))
+		c.telemetry.Set(telemetry.BatchSize, float64(len(job.metrics)))
+		results <- sendResult{batch: job, err: err}
+	}
+}
+
+// dispatch failed batches and then queued metrics to idle workers,
+// batches wait for the next dispatch when every worker is busy
+func (c *Client) dispatch(jobs chan<- batch, state *sendState) {
+	for len(state.pending) > 0 {
+		select {
+		case jobs <- state.pending[0]:
+			state.pending = state.pending[1:]
+			state.inFlight++
+		default:
+			return
+		}
+	}
+
+	metrics := c.queue.Take()
+	if len(metrics) == 0 {
+		return
+	}
+
+	id, err := auth.NewNonce()
+	if err != nil {
+		log.Print(err)
+		c.queue.Requeue(metrics)
+		return
+	}
+
+	select {
+	case jobs <- batch{id: id, metrics: metrics}:
+		state.inFlight++
+	default:
+		c.telemetry.Add(telemetry.DroppedMetrics, uint64(c.queue.Requeue(metrics)))
+	}
+}
+
+// collect current metrics snapshot
+func (c *Client) collect() []models.Metric {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var result []models.Metric
+	for name, value := range c.metrics {
+		if rule, isOk := findAggregation(c.aggregations, name); isOk && !rule.last {
+			continue
+		}
+
+		result = append(result, models.Gauge(name, value))
+	}
+
+	// counter deltas since the last report, queue keeps them until delivery is acknowledged
+	for name, delta := range c.counters {
+		result = append(result, models.Counter(name, delta))
+	}
+	c.counters = map[string]uint64{}
+
+	// samples of the report window, aggregated gauges without new samples are not reported
+	for name, samples := range c.samples {
+		rule, _ := findAggregation(c.aggregations, name)
+		result = append(result, rule.aggregate(name, samples)...)
+	}
+	c.samples = map[string][]float64{}
+	return result
+}
+
+// handle send result, failed batch is kept for retry with the same ID and retry is scheduled.
+// Request could be applied by server even if response is lost, server applies batch ID once
+func (c *Client) handle(result sendResult, state *sendState) {
+	if result.err == nil {
+		c.telemetry.Add(telemetry.SendSuccess, 1)
+		c.telemetry.Succeeded()
+		state.attempt = 0
+		if err := c.queue.Spill(state.pendingMetrics()...); err != nil {
+			log.Print(err)
+		}
+		return
+	}
+
+	c.telemetry.Add(telemetry.SendFailures, 1)
+	if !retryable(result.err) {
+		log.Printf("%d metrics dropped: %s", len(result.batch.metrics), result.err.Error())
+		c.telemetry.Add(telemetry.DroppedMetrics, uint64(len(result.batch.metrics)))
+		return
+	}
+
+	state.pending = append(state.pending, result.batch)
+	if err := c.queue.Spill(state.pendingMetrics()...); err != nil {
+		log.Print(err)
+	}
+
+	state.attempt++
+	if state.armed {
+		return
+	}
+
+	delay := queue.Backoff(state.attempt-1, c.minBackoff, c.maxBackoff)
+	log.Printf("send attempt %d: %s, retry in %s", state.attempt, result.err.Error(), delay)
+	state.retry.Reset(delay)
+	state.armed = true
+}
+
+// send metrics batch
+func (c *Client) send(ctx context.Context, job batch) error {
+	metrics := job.metrics
+	if !c.bodySignature {
+		for i := range metrics {
+			metrics[i].Hash = metrics[i].CalculateHash(c.key)
+		}
+	}
+
+	requestBytes, err := json.Marshal(metrics)
+	if err != nil {
+		return err
+	}
+
 	encryptedBytes := TryEncrypt(requestBytes, c.publicKey)
+	body := encryptedBytes
+	if !c.compression.Disabled {
+		if body, err = compress(encryptedBytes, c.compression.Level); err != nil {
+			return err
+		}
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewBuffer(body))
 	if err != nil {
 		return err
 	}
-	resp, err := http.Post(c.url, "application/json", bytes.NewBuffer(encryptedBytes))
+
+	request.Header.Set("Content-Type", "application/json")
+	if !c.compression.Disabled {
+		request.Header.Set("Content-Encoding", "gzip")
+	}
+	request.Header.Set(models.BatchIDHeader, job.id)
+	if c.publicKey != nil && c.keyID != "" {
+		request.Header.Set(keyring.KeyIDHeader, c.keyID)
+	}
+	if c.token != nil {
+		request.Header.Set("Authorization", "Bearer "+*c.token)
+	}
+
+	if c.key != nil {
+		if err := c.sign(request, encryptedBytes); err != nil {
+			return err
+		}
+		if c.bodySignature {
+			request.Header.Set(models.HashHeader, models.Sign(encryptedBytes, c.key))
+		}
+	}
+
+	resp, err := c.Client.Do(request)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return statusError(resp.StatusCode)
+	}
+
+	responseBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if c.bodySignature && c.key != nil {
+		return verify(resp.Header.Get(models.HashHeader), responseBytes, c.key)
+	}
+	return nil
+}
+
+// statusError unexpected server response status code
+type statusError int
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d", int(e))
+}
+
+// retryable reports whether request failed due to network error or transient server side status,
+// other statuses like 501 for type mismatch are permanent and batch is dropped
+func retryable(err error) bool {
+	var status statusError
+	if errors.As(err, &status) {
+		switch int(status) {
+		case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout, http.StatusTooManyRequests:
+			return true
+		}
+		return false
+	}
+
+	var netErr *url.Error
+	return errors.As(err, &netErr)
+}
+
+// compress request body to gzip, signatures are calculated over uncompressed body
+func compress(body []byte, level int) ([]byte, error) {
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
 
-	err = resp.Body.Close()
+	var buffer bytes.Buffer
+	gz, err := gzip.NewWriterLevel(&buffer, level)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := gz.Write(body); err != nil {
+		return nil, err
+	}
+
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// verify response body hash sum returned by server, unsigned response is rejected
+func verify(hash string, body []byte, key *string) error {
+	if hash == "" {
+		return errors.New("response hash sum is missing")
+	}
+
+	if !hmac.Equal([]byte(models.Sign(body, key)), []byte(hash)) {
+		return errors.New("wrong response hash sum")
+	}
+	return nil
+}
+
+// sign request with timestamp and nonce to protect it from replay
+func (c *Client) sign(request *http.Request, body []byte) error {
+	nonce, err := auth.NewNonce()
 	if err != nil {
 		return err
 	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set(auth.TimestampHeader, timestamp)
+	request.Header.Set(auth.NonceHeader, nonce)
+	request.Header.Set(auth.SignatureHeader, auth.SignRequest(c.key, timestamp, nonce, request.Method, request.URL.Path, body))
 	return nil
 }
 
+// CollectMetrics runs enabled collectors on their poll intervals until context is done
 func (c *Client) CollectMetrics(ctx context.Context, wg *sync.WaitGroup) {
 	defer wg.Done()
-	pollInterval := time.NewTicker(c.pollInterval)
-	for {
-		select {
-		case <-pollInterval.C:
-			v, _ := mem.VirtualMemory()
-			log.Println("CollectMetrics")
-
-			var stats runtime.MemStats
-			runtime.ReadMemStats(&stats)
-			result := map[string]float64{
-				"Alloc":         float64(stats.Alloc),
-				"BuckHashSys":   float64(stats.BuckHashSys),
-				"TotalMemory":   float64(v.Total),
-				"FreeMemory":    float64(v.Free),
-				"Frees":         float64(stats.Frees),
-				"GCCPUFraction": stats.GCCPUFraction,
-				"GCSys":         float64(stats.GCSys),
-				"HeapAlloc":     float64(stats.HeapAlloc),
-				"HeapIdle":      float64(stats.HeapIdle),
-				"HeapInuse":     float64(stats.HeapInuse),
-				"HeapObjects":   float64(stats.HeapObjects),
-				"HeapReleased":  float64(stats.HeapReleased),
-				"HeapSys":       float64(stats.HeapSys),
-				"LastGC":        float64(stats.LastGC),
-				"Lookups":       float64(stats.Lookups),
-				"MCacheInuse":   float64(stats.MCacheInuse),
-				"MCacheSys":     float64(stats.MCacheSys),
-				"MSpanInuse":    float64(stats.MSpanInuse),
-				"MSpanSys":      float64(stats.MSpanSys),
-				"Mallocs":       float64(stats.Mallocs),
-				"NextGC":        float64(stats.NextGC),
-				"NumForcedGC":   float64(stats.NumForcedGC),
-				"NumGC":         float64(stats.NumGC),
-				"OtherSys":      float64(stats.OtherSys),
-				"PauseTotalNs":  float64(stats.PauseTotalNs),
-				"StackInuse":    float64(stats.StackInuse),
-				"StackSys":      float64(stats.StackSys),
-				"Sys":           float64(stats.Sys),
-				"TotalAlloc":    float64(stats.TotalAlloc),
-				"RandomValue":   rand.Float64(),
-			}
-			c.SetMetrics(result)
-		case <-ctx.Done():
-			return
-		}
+
+	var collectors sync.WaitGroup
+	for _, scheduled := range c.collectors {
+		collectors.Add(1)
+		go c.poll(ctx, scheduled, &collectors)
 	}
+	collectors.Wait()
 }
 
-// CollectAdditionalMetrics collect additional metrics
-func (c *Client) CollectAdditionalMetrics(ctx context.Context, wg *sync.WaitGroup) {
+// poll collector on its interval
+func (c *Client) poll(ctx context.Context, scheduled collector.Scheduled, wg *sync.WaitGroup) {
 	defer wg.Done()
-	pollInterval := time.NewTicker(c.pollInterval)
+	pollInterval := time.NewTicker(scheduled.Interval)
+	defer pollInterval.Stop()
+
 	for {
 		select {
 		case <-pollInterval.C:
-			log.Println("CollectAdditionalMetrics")
-			result := make(map[string]float64)
-			info, err := cpu.Percent(time.Second*10, true)
+			started := time.Now()
+			metrics, err := scheduled.Collector.Collect(ctx)
+			c.telemetry.Set(telemetry.CollectDuration+"_"+scheduled.Name, time.Since(started).Seconds())
 			if err != nil {
-				wg.Done()
-				log.Fatal(err)
-			}
-			for i, cp := range info {
-				name := fmt.Sprintf("CPUutilization%d", i)
-				result[name] = cp
+				log.Printf("collector %s: %s", scheduled.Name, err.Error())
+				metrics = append(metrics, models.Counter("CollectErrors_"+scheduled.Name, 1))
 			}
-			c.SetMetrics(result)
+			c.AddMetrics(metrics)
 		case <-ctx.Done():
 			return
 		}
@@ -2,11 +2,23 @@ package app
 
 import (
 	"context"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
 	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/models"
+	"github.com/syols/go-devops/internal/telemetry"
 )
 
 func TestSetMetrics(t *testing.T) {
@@ -32,3 +44,186 @@ func TestSetMetrics(t *testing.T) {
 	wg.Add(1)
 	client.SendMetrics(ctx, &wg)
 }
+
+func TestSendMetricsRateLimit(t *testing.T) {
+	var active, peak, requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if current <= old || atomic.CompareAndSwapInt32(&peak, old, current) {
+				break
+			}
+		}
+		atomic.AddInt32(&requests, 1)
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	require.NoError(t, err)
+	portValue, err := strconv.Atoi(port)
+	require.NoError(t, err)
+
+	cfg := config.Config{}
+	cfg.Server.Address = config.Address{Host: host, Port: uint16(portValue)}
+	cfg.Agent.ReportInterval = time.Millisecond
+	cfg.Agent.ClientTimeout = time.Second
+	cfg.Agent.RateLimit = 2
+
+	client := NewHTTPClient(cfg)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		for ctx.Err() == nil {
+			client.SetMetrics(map[string]float64{"some": rand.Float64()})
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	client.SendMetrics(ctx, &wg)
+
+	assert.Positive(t, atomic.LoadInt32(&requests))
+	assert.LessOrEqual(t, atomic.LoadInt32(&peak), int32(2))
+
+	health, _ := client.Telemetry().Health()
+	assert.NotNil(t, health.LastSuccess)
+	assert.Contains(t, client.Telemetry().String(), telemetry.SendSuccess)
+}
+
+func TestSendMetricsRetry(t *testing.T) {
+	var mutex sync.Mutex
+	var ids []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		ids = append(ids, r.Header.Get(models.BatchIDHeader))
+		if len(ids) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	require.NoError(t, err)
+	portValue, err := strconv.Atoi(port)
+	require.NoError(t, err)
+
+	cfg := config.Config{}
+	cfg.Server.Address = config.Address{Host: host, Port: uint16(portValue)}
+	cfg.Agent.ReportInterval = time.Hour
+	cfg.Agent.ClientTimeout = time.Second
+	cfg.Agent.RateLimit = 1
+	cfg.Agent.Queue.MinBackoff = time.Millisecond
+	cfg.Agent.Queue.MaxBackoff = time.Millisecond
+
+	client := NewHTTPClient(cfg)
+	delta := uint64(3)
+	metrics := []models.Metric{{Name: "PollCount", MetricType: models.CounterName, CounterValue: &delta}}
+
+	var state sendState
+	state.retry = time.NewTimer(time.Hour)
+	defer state.retry.Stop()
+	jobs := make(chan batch, 1)
+	results := make(chan sendResult, 1)
+	client.queue.Push(metrics...)
+	client.dispatch(jobs, &state)
+	close(jobs)
+	client.worker(context.Background(), jobs, results)
+	client.handle(<-results, &state)
+	require.Len(t, state.pending, 1, "failed batch waits for retry")
+
+	jobs = make(chan batch, 1)
+	client.dispatch(jobs, &state)
+	close(jobs)
+	client.worker(context.Background(), jobs, results)
+	client.handle(<-results, &state)
+	assert.Empty(t, state.pending)
+
+	require.Len(t, ids, 2)
+	assert.NotEmpty(t, ids[0])
+	assert.Equal(t, ids[0], ids[1], "retry keeps batch ID")
+}
+
+func TestAggregation(t *testing.T) {
+	cfg := config.Config{}
+	cfg.Agent.Aggregations = []config.AggregationConfig{
+		{Pattern: "^CPU", Functions: []string{"max", "p95"}},
+		{Pattern: "^Load"},
+	}
+	client := NewHTTPClient(cfg)
+
+	for i := 1; i <= 20; i++ {
+		client.SetMetrics(map[string]float64{"CPUutilization0": float64(i), "Load1": float64(i % 4), "Alloc": float64(i)})
+	}
+
+	values := map[string]float64{}
+	for _, metric := range client.collect() {
+		values[metric.Name] = metric.Float()
+	}
+	assert.Equal(t, map[string]float64{
+		"CPUutilization0_max": 20,
+		"CPUutilization0_p95": 19,
+		"Load1":               0,
+		"Load1_min":           0,
+		"Load1_max":           3,
+		"Load1_avg":           1.5,
+		"Load1_p95":           3,
+		"Alloc":               20,
+	}, values)
+
+	values = map[string]float64{}
+	for _, metric := range client.collect() {
+		values[metric.Name] = metric.Float()
+	}
+	assert.Equal(t, map[string]float64{"Load1": 0, "Alloc": 20}, values, "window without samples")
+}
+
+func TestSendUnsignedResponse(t *testing.T) {
+	key := "signed_key"
+	signed := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := []byte("[]")
+		if signed {
+			w.Header().Set(models.HashHeader, models.Sign(body, &key))
+		}
+		_, _ = w.Write(body)
+	}))
+	defer server.Close()
+
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	require.NoError(t, err)
+	portValue, err := strconv.Atoi(port)
+	require.NoError(t, err)
+
+	cfg := config.Config{}
+	cfg.Server.Address = config.Address{Host: host, Port: uint16(portValue)}
+	cfg.Server.Key = &key
+	cfg.Agent.BodySignature = true
+	cfg.Agent.ClientTimeout = time.Second
+	client := NewHTTPClient(cfg)
+
+	err = client.send(context.Background(), batch{})
+	assert.NoError(t, err)
+
+	signed = false
+	err = client.send(context.Background(), batch{})
+	assert.Error(t, err, "response signature stripped")
+}
+
+func TestRetryable(t *testing.T) {
+	for status, expected := range map[int]bool{
+		http.StatusInternalServerError: true,
+		http.StatusBadGateway:          true,
+		http.StatusServiceUnavailable:  true,
+		http.StatusGatewayTimeout:      true,
+		http.StatusTooManyRequests:     true,
+		http.StatusNotImplemented:      false,
+		http.StatusBadRequest:          false,
+	} {
+		assert.Equal(t, expected, retryable(statusError(status)), status)
+	}
+}
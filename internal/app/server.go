@@ -2,9 +2,6 @@ package app
 
 import (
 	"context"
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
 	"fmt"
 	"log"
 	"net/http"
@@ -12,21 +9,38 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 
 	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/auth"
+	"github.com/syols/go-devops/internal/derived"
 	"github.com/syols/go-devops/internal/handlers"
+	"github.com/syols/go-devops/internal/history"
+	"github.com/syols/go-devops/internal/keyring"
+	"github.com/syols/go-devops/internal/models"
+	"github.com/syols/go-devops/internal/notify"
+	"github.com/syols/go-devops/internal/query"
+	"github.com/syols/go-devops/internal/statsd"
 	"github.com/syols/go-devops/internal/store"
 )
 
 // Server struct
 type Server struct {
-	server     http.Server
-	metrics    store.MetricsStorage
-	settings   config.Config
-	privateKey *rsa.PrivateKey
+	server      http.Server
+	debugServer *http.Server
+	metrics     store.MetricsStorage
+	history     history.History
+	tenants     handlers.Tenants
+	tokens      *auth.Tokens
+	replay      *auth.ReplayGuard
+	batches     *handlers.Batches
+	settings    config.Config
+	keys        *keyring.Keyring
+	derived     *derived.Engine
+	statsd      *statsd.Server
 }
 
 // NewServer creates server struct
@@ -36,28 +50,60 @@ func NewServer(settings config.Config) (Server, error) {
 		return Server{}, err
 	}
 
-	var privateKey *rsa.PrivateKey
-	if settings.Store.CryptoKeyFilePath != nil {
-		byteArr, err := os.ReadFile(*settings.Store.CryptoKeyFilePath) // just pass the file name
-		if err != nil {
-			fmt.Print(err)
-		}
+	notifier, err := notify.NewNotifier(context.Background(), settings)
+	if err != nil {
+		return Server{}, err
+	}
+	metrics.AddHook(notifier.Notify)
 
-		blocks, _ := pem.Decode(byteArr)
-		if blocks != nil {
-			log.Fatal("Error at decode")
+	tenants, err := handlers.NewTenants(settings)
+	if err != nil {
+		return Server{}, err
+	}
+
+	engine, err := derived.NewEngine(settings.Server.Derived, metrics, tenants.Key)
+	if err != nil {
+		return Server{}, err
+	}
+	metrics.AddHook(engine.Update)
+
+	var samples history.History
+	if settings.Store.History.Enabled {
+		if samples, err = history.NewHistory(settings); err != nil {
+			return Server{}, err
 		}
+		metrics.AddHook(history.Recorder(samples))
+	}
 
-		privateKey, err = x509.ParsePKCS1PrivateKey(blocks.Bytes)
-		if err != nil {
-			fmt.Print(err)
+	tokens, err := auth.NewTokens(settings)
+	if err != nil {
+		return Server{}, err
+	}
+
+	keys, err := keyring.NewKeyring(settings)
+	if err != nil {
+		return Server{}, err
+	}
+
+	var statsdServer *statsd.Server
+	if statsdSettings := settings.Server.Statsd; statsdSettings.Address != nil {
+		if _, isOk := tenants[statsdSettings.Tenant]; !isOk {
+			return Server{}, fmt.Errorf("unknown statsd tenant %q", statsdSettings.Tenant)
 		}
+		statsdServer = statsd.NewServer(statsdSettings, applyStatsd(statsdSettings.Tenant, tenants, engine, metrics))
 	}
 
 	return Server{
-		metrics:    metrics,
-		settings:   settings,
-		privateKey: privateKey,
+		metrics:  metrics,
+		history:  samples,
+		tenants:  tenants,
+		tokens:   tokens,
+		replay:   auth.NewReplayGuard(settings.Server.Replay),
+		batches:  handlers.NewBatches(),
+		settings: settings,
+		keys:     keys,
+		derived:  engine,
+		statsd:   statsdServer,
 	}, nil
 }
 
@@ -66,13 +112,40 @@ func (s *Server) Run() {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
 	defer cancel()
 	s.shutdown(ctx)
+	go s.tokens.Watch(ctx)
+	go s.keys.Watch(ctx)
+
+	if s.statsd != nil {
+		go func() {
+			if err := s.statsd.Run(ctx); err != nil {
+				log.Print(err)
+			}
+		}()
+	}
+
+	if debug := s.settings.Server.Debug; !debug.Disabled && debug.Address != nil {
+		debugRouter := chi.NewRouter()
+		debugRouter.Use(middleware.Logger)
+		debugRouter.Use(middleware.Recoverer)
+		debugRouter.Group(s.debugRouter)
 
-	server := http.Server{
+		s.debugServer = &http.Server{
+			Addr:    debug.Address.String(),
+			Handler: debugRouter,
+		}
+		go func() {
+			if err := s.debugServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Print(err)
+			}
+		}()
+	}
+
+	s.server = http.Server{
 		Addr:    s.settings.Address(),
 		Handler: s.router(),
 	}
 
-	if err := server.ListenAndServe(); err != nil {
+	if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatal(err)
 	}
 }
@@ -81,33 +154,88 @@ func (s *Server) router() *chi.Mux {
 	router := chi.NewRouter()
 	router.Use(middleware.Logger)
 	router.Use(middleware.Recoverer)
-	router.Use(handlers.Compress)
-	router.Use(handlers.Save(s.metrics))
-
-	router.Get("/", handlers.Healthcheck)
-	router.Get("/ping", handlers.Ping(s.metrics))
-	router.Get("/value/{type}/{name}", handlers.Value(s.metrics))
-	router.Post("/update/{type}/{name}/{value}", handlers.Update(s.metrics))
-	router.Post("/update/", handlers.UpdateJSON(s.metrics, s.settings.Server.Key))
-	router.Post("/updates/", handlers.UpdatesJSON(s.metrics, s.settings.Server.Key, s.privateKey))
-	router.Post("/value/", handlers.ValueJSON(s.metrics))
-
-	// pprof
+
+	router.Group(func(router chi.Router) {
+		router.Use(handlers.Compress(s.settings.Server.Compression))
+		router.Use(handlers.Decompress)
+		router.Use(handlers.Save(s.metrics))
+		router.Get("/", handlers.Healthcheck)
+		router.Get("/ping", handlers.Ping(s.metrics))
+		router.Group(s.metricsRouter)
+		router.Route("/tenants/{tenant}", s.metricsRouter)
+	})
+	return router
+}
+
+func (s *Server) debugRouter(router chi.Router) {
+	router.Use(handlers.Authorize(s.tokens, auth.DebugScope))
 	router.HandleFunc("/debug/pprof/", pprof.Index)
 	router.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
 	router.HandleFunc("/debug/pprof/profile", pprof.Profile)
 	router.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
 	router.HandleFunc("/debug/pprof/trace", pprof.Trace)
-	return router
+	for _, profile := range []string{"allocs", "block", "goroutine", "heap", "mutex", "threadcreate"} {
+		router.Handle("/debug/pprof/"+profile, pprof.Handler(profile))
+	}
+}
+
+func (s *Server) metricsRouter(router chi.Router) {
+	router.Use(handlers.Tenant(s.tenants))
+	router.Use(handlers.BodySignature(s.tenants))
+	router.Group(func(router chi.Router) {
+		router.Use(handlers.Authorize(s.tokens, auth.ReadScope))
+		router.Use(handlers.ReadAccess(s.replay, s.tokens, s.tenants))
+		router.Get("/value/{type}/{name}", handlers.Value(s.metrics))
+		router.Post("/value/", handlers.ValueJSON(s.metrics, s.tenants))
+		router.Get("/query", handlers.Query(query.NewEngine(s.metrics, s.history)))
+		if s.history != nil {
+			router.Get("/history/{type}/{name}", handlers.History(s.metrics, s.history))
+		}
+	})
+	router.Group(func(router chi.Router) {
+		router.Use(handlers.Authorize(s.tokens, auth.WriteScope))
+		router.Use(handlers.Replay(s.replay, s.tenants))
+		router.Post("/update/{type}/{name}/{value}", handlers.Update(s.metrics, s.tenants, s.derived.Derived))
+		router.Post("/update/", handlers.UpdateJSON(s.metrics, s.tenants, s.derived.Derived))
+		router.With(handlers.Idempotent(s.batches)).Post("/updates/", handlers.UpdatesJSON(s.metrics, s.tenants, s.keys, s.derived.Derived))
+	})
+}
+
+// applyStatsd stores flushed StatsD metrics like updates of trusted agents, StatsD has no signatures
+func applyStatsd(tenant string, tenants handlers.Tenants, engine *derived.Engine, metrics store.MetricsStorage) statsd.Apply {
+	return func(metric models.Metric) error {
+		metric.Tenant = tenant
+		_, err := handlers.Apply(metric, tenants.Key(tenant), true, engine.Derived, metrics)
+		return err
+	}
 }
 
 func (s *Server) shutdown(ctx context.Context) {
 	go func() {
 		<-ctx.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if s.debugServer != nil {
+			if err := s.debugServer.Shutdown(ctx); err != nil {
+				log.Print(err)
+			}
+		}
+
 		if err := s.server.Shutdown(ctx); err != nil {
 			log.Fatal(err)
 		}
 
+		if s.statsd != nil {
+			s.statsd.Flush()
+		}
+
+		if s.history != nil {
+			if err := s.history.Flush(ctx); err != nil {
+				log.Print(err)
+			}
+		}
+
 		if s.settings.Store.DatabaseConnectionString == nil {
 			err := s.metrics.Save(ctx)
 			if err != nil {
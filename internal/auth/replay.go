@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/models"
+)
+
+// Request signature headers
+const (
+	TimestampHeader = "X-Timestamp"
+	NonceHeader     = "X-Nonce"
+	SignatureHeader = "X-Signature"
+)
+
+const defaultClockSkew = time.Minute
+
+// ReplayGuard verifies request signatures and rejects replayed nonces
+type ReplayGuard struct {
+	skew   time.Duration
+	nonces map[string]time.Time
+	swept  time.Time
+	now    func() time.Time
+	mutex  sync.Mutex
+}
+
+// NewReplayGuard creates replay guard
+func NewReplayGuard(settings config.ReplayConfig) *ReplayGuard {
+	skew := settings.ClockSkew
+	if skew <= 0 {
+		skew = defaultClockSkew
+	}
+
+	return &ReplayGuard{
+		skew:   skew,
+		nonces: map[string]time.Time{},
+		now:    time.Now,
+	}
+}
+
+// NewNonce generates random request nonce
+func NewNonce() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", nonce), nil
+}
+
+// SignRequest calculates signature covering timestamp, nonce, method, path and body
+func SignRequest(key *string, timestamp, nonce, method, path string, body []byte) string {
+	payload := []byte(strings.Join([]string{timestamp, nonce, method, path, ""}, ":"))
+	return models.Sign(append(payload, body...), key)
+}
+
+// Verify checks request signature, timestamp skew and nonce uniqueness in namespace
+func (g *ReplayGuard) Verify(key *string, namespace, timestamp, nonce, signature, method, path string, body []byte) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("wrong timestamp")
+	}
+
+	if nonce == "" {
+		return errors.New("empty nonce")
+	}
+
+	expected := SignRequest(key, timestamp, nonce, method, path, body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return errors.New("wrong request signature")
+	}
+
+	now := g.now()
+	sent := time.Unix(seconds, 0)
+	if sent.Before(now.Add(-g.skew)) || sent.After(now.Add(g.skew)) {
+		return errors.New("request timestamp is out of allowed clock skew")
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if now.Sub(g.swept) > g.skew {
+		for cached, expires := range g.nonces {
+			if expires.Before(now) {
+				delete(g.nonces, cached)
+			}
+		}
+		g.swept = now
+	}
+
+	cacheKey := namespace + "/" + nonce
+	if _, isOk := g.nonces[cacheKey]; isOk {
+		return errors.New("replayed request")
+	}
+	g.nonces[cacheKey] = sent.Add(2 * g.skew)
+	return nil
+}
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/syols/go-devops/config"
+)
+
+func TestReplayGuard(t *testing.T) {
+	key := "some_key"
+	body := []byte(`[{"id":"PollCount","type":"counter","delta":1}]`)
+	guard := NewReplayGuard(config.ReplayConfig{ClockSkew: time.Minute})
+	now := time.Now()
+	guard.now = func() time.Time { return now }
+
+	nonce, err := NewNonce()
+	require.NoError(t, err)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	signature := SignRequest(&key, timestamp, nonce, http.MethodPost, "/updates/", body)
+
+	assert.NoError(t, guard.Verify(&key, "", timestamp, nonce, signature, http.MethodPost, "/updates/", body))
+	assert.Error(t, guard.Verify(&key, "", timestamp, nonce, signature, http.MethodPost, "/updates/", body), "replay")
+	assert.NoError(t, guard.Verify(&key, "team", timestamp, nonce, signature, http.MethodPost, "/updates/", body))
+
+	nonce, err = NewNonce()
+	require.NoError(t, err)
+	signature = SignRequest(&key, timestamp, nonce, http.MethodPost, "/updates/", body)
+	assert.Error(t, guard.Verify(&key, "", timestamp, nonce, signature, http.MethodPost, "/update/", body), "path")
+	assert.Error(t, guard.Verify(&key, "", timestamp, nonce, signature, http.MethodPost, "/updates/", []byte("[]")), "body")
+
+	old := strconv.FormatInt(now.Add(-2*time.Minute).Unix(), 10)
+	signature = SignRequest(&key, old, nonce, http.MethodPost, "/updates/", body)
+	assert.Error(t, guard.Verify(&key, "", old, nonce, signature, http.MethodPost, "/updates/", body), "skew")
+}
@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/syols/go-devops/config"
+)
+
+// Token scopes
+const (
+	ReadScope  = "read"
+	WriteScope = "write"
+	DebugScope = "debug"
+	AdminScope = "admin"
+)
+
+const watchInterval = 10 * time.Second
+
+type grant struct {
+	scopes  map[string]struct{}
+	tenants map[string]struct{}
+}
+
+// Tokens API tokens with scopes and tenants, admin scope grants every scope and tenant
+type Tokens struct {
+	static  map[string]grant
+	file    map[string]grant
+	path    *string
+	modTime time.Time
+	mutex   sync.RWMutex
+}
+
+// NewTokens creates tokens from config and tokens file
+func NewTokens(settings config.Config) (*Tokens, error) {
+	static, err := newGrants(settings.Server.Tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := Tokens{
+		static: static,
+		file:   map[string]grant{},
+		path:   settings.Server.TokensFile,
+	}
+
+	if err := tokens.Reload(); err != nil {
+		return nil, err
+	}
+	return &tokens, nil
+}
+
+// Enabled reports whether any token is configured
+func (t *Tokens) Enabled() bool {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return len(t.static) > 0 || len(t.file) > 0 || t.path != nil
+}
+
+// Allowed checks whether token has scope
+func (t *Tokens) Allowed(token, scope string) bool {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	granted, isOk := t.grant(token)
+	if !isOk {
+		return false
+	}
+	_, hasScope := granted.scopes[scope]
+	_, isAdmin := granted.scopes[AdminScope]
+	return hasScope || isAdmin
+}
+
+// TenantAllowed checks whether token grants access to private tenant
+func (t *Tokens) TenantAllowed(token, tenant string) bool {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	granted, isOk := t.grant(token)
+	if !isOk {
+		return false
+	}
+	_, hasTenant := granted.tenants[tenant]
+	_, isAdmin := granted.scopes[AdminScope]
+	return hasTenant || isAdmin
+}
+
+func (t *Tokens) grant(token string) (grant, bool) {
+	key := hash(token)
+	for _, tokens := range []map[string]grant{t.static, t.file} {
+		if granted, isOk := tokens[key]; isOk {
+			return granted, true
+		}
+	}
+	return grant{}, false
+}
+
+// Known checks whether token exists
+func (t *Tokens) Known(token string) bool {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	key := hash(token)
+	_, isStatic := t.static[key]
+	_, isFile := t.file[key]
+	return isStatic || isFile
+}
+
+// Reload tokens file if it has been changed
+func (t *Tokens) Reload() error {
+	if t.path == nil {
+		return nil
+	}
+
+	info, err := os.Stat(*t.path)
+	if err != nil {
+		return err
+	}
+
+	t.mutex.RLock()
+	unchanged := info.ModTime().Equal(t.modTime)
+	t.mutex.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	content, err := os.ReadFile(*t.path)
+	if err != nil {
+		return err
+	}
+
+	var settings []config.TokenConfig
+	if err := json.Unmarshal(content, &settings); err != nil {
+		return err
+	}
+
+	file, err := newGrants(settings)
+	if err != nil {
+		return err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.file = file
+	t.modTime = info.ModTime()
+	log.Printf("Loaded %d tokens from %s", len(file), *t.path)
+	return nil
+}
+
+// Watch reloads tokens file until context is done
+func (t *Tokens) Watch(ctx context.Context) {
+	if t.path == nil {
+		return
+	}
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := t.Reload(); err != nil {
+				log.Print(err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func newGrants(settings []config.TokenConfig) (map[string]grant, error) {
+	result := map[string]grant{}
+	for _, token := range settings {
+		if token.Token == "" {
+			return nil, fmt.Errorf("empty token")
+		}
+
+		granted := grant{scopes: map[string]struct{}{}, tenants: map[string]struct{}{}}
+		for _, scope := range token.Scopes {
+			switch scope {
+			case ReadScope, WriteScope, DebugScope, AdminScope:
+				granted.scopes[scope] = struct{}{}
+			default:
+				return nil, fmt.Errorf("unknown scope %q", scope)
+			}
+		}
+		for _, tenant := range token.Tenants {
+			granted.tenants[tenant] = struct{}{}
+		}
+		result[hash(token.Token)] = granted
+	}
+	return result, nil
+}
+
+func hash(token string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
+}
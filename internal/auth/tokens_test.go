@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/syols/go-devops/config"
+)
+
+func TestTokens(t *testing.T) {
+	tokens, err := NewTokens(config.Config{Server: config.ServerConfig{
+		Tokens: []config.TokenConfig{
+			{Token: "reader", Scopes: []string{ReadScope}, Tenants: []string{"team"}},
+			{Token: "root", Scopes: []string{AdminScope}},
+		},
+	}})
+	require.NoError(t, err)
+
+	assert.True(t, tokens.Enabled())
+	assert.True(t, tokens.Allowed("reader", ReadScope))
+	assert.False(t, tokens.Allowed("reader", WriteScope))
+	assert.True(t, tokens.Allowed("root", DebugScope))
+	assert.False(t, tokens.Known("unknown"))
+	assert.True(t, tokens.TenantAllowed("reader", "team"))
+	assert.False(t, tokens.TenantAllowed("reader", "other"))
+	assert.True(t, tokens.TenantAllowed("root", "other"))
+
+	tokens, err = NewTokens(config.Config{})
+	require.NoError(t, err)
+	assert.False(t, tokens.Enabled())
+
+	_, err = NewTokens(config.Config{Server: config.ServerConfig{
+		Tokens: []config.TokenConfig{{Token: "some", Scopes: []string{"unknown"}}},
+	}})
+	assert.Error(t, err)
+}
+
+func TestTokensFileRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"token": "old", "scopes": ["write"]}]`), 0600))
+
+	tokens, err := NewTokens(config.Config{Server: config.ServerConfig{TokensFile: &path}})
+	require.NoError(t, err)
+	assert.True(t, tokens.Allowed("old", WriteScope))
+
+	require.NoError(t, os.WriteFile(path, []byte(`[{"token": "new", "scopes": ["write"]}]`), 0600))
+	modTime := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+	require.NoError(t, tokens.Reload())
+
+	assert.False(t, tokens.Known("old"))
+	assert.True(t, tokens.Allowed("new", WriteScope))
+}
@@ -0,0 +1,100 @@
+package collector
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/models"
+)
+
+// Builtin collector names
+const (
+	RuntimeName   = "runtime"
+	MemoryName    = "memory"
+	CPUName       = "cpu"
+	DiskName      = "disk"
+	NetworkName   = "network"
+	LoadName      = "load"
+	ProcessesName = "processes"
+	ProcessName   = "process"
+	ExecName      = "exec"
+	ScrapeName    = "scrape"
+)
+
+// Collector collects metrics of one source. Partial result may be returned with error
+type Collector interface {
+	Collect(ctx context.Context) ([]models.Metric, error)
+}
+
+// Factory creates collector from config
+type Factory func(settings config.Config) (Collector, error)
+
+// Registry collector factories by name
+type Registry map[string]Factory
+
+// Scheduled collector with its poll interval
+type Scheduled struct {
+	Name      string
+	Collector Collector
+	Interval  time.Duration
+}
+
+// NewRegistry creates registry of builtin collectors
+func NewRegistry() Registry {
+	return Registry{
+		RuntimeName:   NewRuntime,
+		MemoryName:    NewMemory,
+		CPUName:       NewCPU,
+		DiskName:      NewDisk,
+		NetworkName:   NewNetwork,
+		LoadName:      NewLoad,
+		ProcessesName: NewProcesses,
+		ProcessName:   NewProcess,
+		ExecName:      NewExec,
+		ScrapeName:    NewScrape,
+	}
+}
+
+// Register collector factory
+func (r Registry) Register(name string, factory Factory) {
+	r[name] = factory
+}
+
+// Build creates enabled collectors, poll interval defaults to agent poll interval
+func (r Registry) Build(settings config.Config) []Scheduled {
+	for name := range settings.Agent.Collectors {
+		if _, isOk := r[name]; !isOk {
+			log.Printf("unknown collector %s", name)
+		}
+	}
+
+	names := make([]string, 0, len(r))
+	for name := range r {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var result []Scheduled
+	for _, name := range names {
+		collectorSettings := settings.Agent.Collectors[name]
+		if collectorSettings.Disabled {
+			continue
+		}
+
+		collector, err := r[name](settings)
+		if err != nil {
+			log.Printf("collector %s: %s", name, err.Error())
+			continue
+		}
+
+		interval := collectorSettings.PollInterval
+		if interval <= 0 {
+			interval = settings.Agent.PollInterval
+		}
+		result = append(result, Scheduled{Name: name, Collector: collector, Interval: interval})
+	}
+	return result
+}
@@ -0,0 +1,391 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/models"
+)
+
+func TestRegistryBuild(t *testing.T) {
+	settings := config.Config{Agent: config.AgentConfig{
+		PollInterval: time.Second,
+		Collectors: config.CollectorsConfig{
+			CPUName:    {Disabled: true},
+			MemoryName: {PollInterval: time.Minute},
+		},
+	}}
+
+	intervals := map[string]time.Duration{}
+	for _, scheduled := range NewRegistry().Build(settings) {
+		intervals[scheduled.Name] = scheduled.Interval
+	}
+
+	assert.NotContains(t, intervals, CPUName)
+	assert.Equal(t, time.Minute, intervals[MemoryName])
+	assert.Equal(t, time.Second, intervals[RuntimeName])
+
+	registry := Registry{"broken": func(config.Config) (Collector, error) { return nil, errors.New("broken") }}
+	assert.Empty(t, registry.Build(settings))
+}
+
+func TestRuntime(t *testing.T) {
+	collector := Runtime{
+		readMemStats: func(stats *runtime.MemStats) { stats.Alloc = 42 },
+		random:       func() float64 { return 0.5 },
+	}
+
+	metrics, err := collector.Collect(context.Background())
+	require.NoError(t, err)
+	result := models.Values(metrics)
+	assert.Equal(t, float64(42), result["Alloc"])
+	assert.Equal(t, 0.5, result["RandomValue"])
+	assert.Equal(t, float64(1), result["PollCount"])
+}
+
+func TestMemory(t *testing.T) {
+	collector := Memory{virtualMemory: func(context.Context) (*mem.VirtualMemoryStat, error) {
+		return &mem.VirtualMemoryStat{Total: 100, Free: 40, UsedPercent: 60}, nil
+	}}
+
+	metrics, err := collector.Collect(context.Background())
+	require.NoError(t, err)
+	result := models.Values(metrics)
+	assert.Equal(t, float64(100), result["TotalMemory"])
+	assert.Equal(t, float64(40), result["FreeMemory"])
+	assert.Equal(t, float64(60), result["UsedMemoryPercent"])
+}
+
+func TestCPU(t *testing.T) {
+	cores := []cpu.TimesStat{{CPU: "cpu0", User: 10, Idle: 90}, {CPU: "cpu1", User: 10, Idle: 90}}
+	collector := CPU{
+		times: func(_ context.Context, percpu bool) ([]cpu.TimesStat, error) {
+			if percpu {
+				return cores, nil
+			}
+			total := cpu.TimesStat{CPU: "cpu-total"}
+			for _, core := range cores {
+				total.User += core.User
+				total.Idle += core.Idle
+				total.Iowait += core.Iowait
+				total.Steal += core.Steal
+			}
+			return []cpu.TimesStat{total}, nil
+		},
+		previous: map[string]cpu.TimesStat{},
+	}
+
+	metrics, err := collector.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, metrics, "first poll only takes snapshot")
+
+	cores = []cpu.TimesStat{{CPU: "cpu0", User: 60, Idle: 140}, {CPU: "cpu1", User: 10, Idle: 170, Iowait: 10, Steal: 10}}
+	metrics, err = collector.Collect(context.Background())
+	require.NoError(t, err)
+	result := models.Values(metrics)
+	assert.Equal(t, float64(50), result["CPUutilization0"])
+	assert.Equal(t, float64(50), result["CPUuser0"])
+	assert.Equal(t, float64(10), result["CPUutilization1"])
+	assert.Equal(t, float64(10), result["CPUiowait1"])
+	assert.Equal(t, float64(10), result["CPUsteal1"])
+	assert.Equal(t, float64(30), result["CPUutilization"])
+
+	collector.times = func(context.Context, bool) ([]cpu.TimesStat, error) {
+		return nil, errors.New("unavailable")
+	}
+	_, err = collector.Collect(context.Background())
+	assert.Error(t, err)
+}
+
+func TestDisk(t *testing.T) {
+	mounts, err := newFilter(config.FilterConfig{Exclude: []string{"^/proc"}})
+	require.NoError(t, err)
+	devices, err := newFilter(config.FilterConfig{Include: []string{"^sd"}})
+	require.NoError(t, err)
+
+	now := time.Now()
+	read := uint64(1000)
+	collector := Disk{
+		partitions: func(context.Context, bool) ([]disk.PartitionStat, error) {
+			return []disk.PartitionStat{{Mountpoint: "/"}, {Mountpoint: "/root"}, {Mountpoint: "/var/lib"}, {Mountpoint: "/proc"}}, nil
+		},
+		usage: func(_ context.Context, path string) (*disk.UsageStat, error) {
+			return &disk.UsageStat{Path: path, Total: 10, Used: 4, Free: uint64(len(path)), InodesFree: 3}, nil
+		},
+		ioCounters: func(context.Context, ...string) (map[string]disk.IOCountersStat, error) {
+			return map[string]disk.IOCountersStat{
+				"sda":   {ReadBytes: read, ReadCount: read / 100},
+				"loop0": {ReadBytes: read},
+			}, nil
+		},
+		now:     func() time.Time { return now },
+		mounts:  mounts,
+		devices: devices,
+	}
+
+	metrics, err := collector.Collect(context.Background())
+	require.NoError(t, err)
+	result := models.Values(metrics)
+	assert.Equal(t, float64(1), result["DiskFree_rootfs"])
+	assert.Equal(t, float64(5), result["DiskFree_root"])
+	assert.Equal(t, float64(3), result["DiskInodesFree_var_lib"])
+	assert.NotContains(t, result, "DiskFree_proc")
+	assert.NotContains(t, result, "DiskReadBytesRate_sda", "first poll has no rates")
+
+	now = now.Add(2 * time.Second)
+	read = 3000
+	metrics, err = collector.Collect(context.Background())
+	require.NoError(t, err)
+	result = models.Values(metrics)
+	assert.Equal(t, float64(1000), result["DiskReadBytesRate_sda"])
+	assert.Equal(t, float64(10), result["DiskReadOpsRate_sda"])
+	assert.NotContains(t, result, "DiskReadBytesRate_loop0")
+}
+
+func TestNetwork(t *testing.T) {
+	interfaces, err := newFilter(config.FilterConfig{Exclude: []string{"^lo$"}})
+	require.NoError(t, err)
+
+	now := time.Now()
+	sent := uint64(100)
+	collector := Network{
+		counters: func(context.Context, bool) ([]net.IOCountersStat, error) {
+			return []net.IOCountersStat{{Name: "eth0", BytesSent: sent}, {Name: "lo", BytesSent: sent}}, nil
+		},
+		connections: func(context.Context, string) ([]net.ConnectionStat, error) {
+			return []net.ConnectionStat{{Status: "ESTABLISHED"}, {Status: "ESTABLISHED"}, {Status: "LISTEN"}}, nil
+		},
+		now:        func() time.Time { return now },
+		interfaces: interfaces,
+	}
+
+	metrics, err := collector.Collect(context.Background())
+	require.NoError(t, err)
+	result := models.Values(metrics)
+	assert.NotContains(t, result, "NetworkBytesSent_eth0", "first poll has no deltas")
+	assert.Equal(t, float64(2), result["TCPConnections_ESTABLISHED"])
+	assert.Equal(t, float64(0), result["TCPConnections_TIME_WAIT"])
+
+	now = now.Add(2 * time.Second)
+	sent = 300
+	metrics, err = collector.Collect(context.Background())
+	require.NoError(t, err)
+	for _, metric := range metrics {
+		if metric.Name == "NetworkBytesSent_eth0" {
+			assert.Equal(t, models.CounterName, metric.MetricType)
+			assert.Equal(t, uint64(200), *metric.CounterValue)
+		}
+	}
+	result = models.Values(metrics)
+	assert.Contains(t, result, "NetworkBytesSent_eth0")
+	assert.Equal(t, float64(100), result["NetworkBytesSentRate_eth0"])
+	assert.NotContains(t, result, "NetworkBytesSent_lo")
+}
+
+func TestLoad(t *testing.T) {
+	collector := Load{avg: func(context.Context) (*load.AvgStat, error) {
+		return &load.AvgStat{Load1: 1, Load5: 0.5, Load15: 0.25}, nil
+	}}
+
+	metrics, err := collector.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"Load1": 1, "Load5": 0.5, "Load15": 0.25}, models.Values(metrics))
+}
+
+func TestProcesses(t *testing.T) {
+	collector := Processes{misc: func(context.Context) (*load.MiscStat, error) {
+		return &load.MiscStat{ProcsTotal: 100, ProcsRunning: 2, ProcsBlocked: 1}, nil
+	}}
+
+	metrics, err := collector.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"ProcessesTotal": 100, "ProcessesRunning": 2, "ProcessesBlocked": 1}, models.Values(metrics))
+}
+
+type fakeProcess struct {
+	name    string
+	cmdline string
+	created int64
+	cpu     float64
+}
+
+func (f *fakeProcess) NameWithContext(context.Context) (string, error) {
+	return f.name, nil
+}
+
+func (f *fakeProcess) CmdlineWithContext(context.Context) (string, error) {
+	return f.cmdline, nil
+}
+
+func (f *fakeProcess) CreateTimeWithContext(context.Context) (int64, error) {
+	return f.created, nil
+}
+
+func (f *fakeProcess) MemoryInfoWithContext(context.Context) (*process.MemoryInfoStat, error) {
+	return &process.MemoryInfoStat{RSS: 1024}, nil
+}
+
+func (f *fakeProcess) TimesWithContext(context.Context) (*cpu.TimesStat, error) {
+	return &cpu.TimesStat{User: f.cpu}, nil
+}
+
+func (f *fakeProcess) NumFDsWithContext(context.Context) (int32, error) {
+	return 8, nil
+}
+
+func (f *fakeProcess) NumThreadsWithContext(context.Context) (int32, error) {
+	return 4, nil
+}
+
+func TestProcess(t *testing.T) {
+	now := time.Now()
+	started := now.Add(-time.Minute).UnixNano() / int64(time.Millisecond)
+	processes := map[int32]*fakeProcess{
+		10: {name: "nginx", cmdline: "nginx: master", created: started, cpu: 1},
+		11: {name: "nginx", cmdline: "nginx: worker", created: started, cpu: 1},
+		20: {name: "server", cmdline: "/usr/bin/server -a :8080", created: started},
+	}
+
+	collector, err := NewProcess(config.Config{Agent: config.AgentConfig{Processes: []config.ProcessConfig{
+		{Name: "nginx", ProcessName: "nginx"},
+		{Name: "server", Cmdline: "server -a"},
+		{Name: "db", Pidfile: "/run/db.pid"},
+	}}})
+	require.NoError(t, err)
+
+	fake := collector.(*Process)
+	fake.pids = func(context.Context) ([]int32, error) { return []int32{10, 11, 20}, nil }
+	fake.open = func(_ context.Context, pid int32) (processInfo, error) {
+		if info, isOk := processes[pid]; isOk {
+			return info, nil
+		}
+		return nil, errors.New("no such process")
+	}
+	fake.readFile = func(string) ([]byte, error) { return []byte("30\n"), nil }
+	fake.now = func() time.Time { return now }
+
+	metrics, err := fake.Collect(context.Background())
+	require.NoError(t, err)
+	result := models.Values(metrics)
+	assert.Equal(t, float64(2), result["ProcessCount_nginx"])
+	assert.Equal(t, float64(2048), result["ProcessRSS_nginx"])
+	assert.Equal(t, float64(1), result["ProcessCount_server"])
+	assert.Equal(t, float64(0), result["ProcessCount_db"], "pidfile process is not running")
+	assert.InDelta(t, 60, result["ProcessUptime_server"], 1)
+
+	now = now.Add(2 * time.Second)
+	processes[10].cpu = 2
+	processes[11] = &fakeProcess{name: "nginx", created: now.UnixNano() / int64(time.Millisecond), cpu: 5}
+	metrics, err = fake.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, float64(50), models.Values(metrics)["ProcessCPUPercent_nginx"], "restarted worker has no CPU baseline")
+
+	_, err = NewProcess(config.Config{Agent: config.AgentConfig{Processes: []config.ProcessConfig{
+		{Name: "ambiguous", ProcessName: "nginx", Pidfile: "/run/nginx.pid"},
+	}}})
+	assert.Error(t, err)
+}
+
+func TestExec(t *testing.T) {
+	settings := config.Config{Agent: config.AgentConfig{Exec: []config.ExecConfig{
+		{Name: "text", Command: "testdata/text.sh", Interval: time.Minute},
+		{Name: "json", Command: "testdata/json.sh"},
+	}}}
+	collector, err := NewExec(settings)
+	require.NoError(t, err)
+
+	now := time.Unix(1000, 0)
+	collector.(*Exec).now = func() time.Time { return now }
+	metrics, err := collector.Collect(context.Background())
+	assert.Error(t, err, "broken line")
+	assert.Equal(t, map[string]float64{"QueueLength": 12.5, "JobsDone": 3, "Temperature": 36.6, "Restarts": 1}, models.Values(metrics))
+
+	now = now.Add(time.Second)
+	metrics, err = collector.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"Temperature": 36.6, "Restarts": 1}, models.Values(metrics), "text interval has not elapsed")
+}
+
+func TestExecFailure(t *testing.T) {
+	settings := config.Config{Agent: config.AgentConfig{Exec: []config.ExecConfig{
+		{Name: "fail", Command: "testdata/fail.sh"},
+	}}}
+	collector, err := NewExec(settings)
+	require.NoError(t, err)
+
+	metrics, err := collector.Collect(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "disk is not mounted")
+	assert.Equal(t, map[string]float64{"Partial": 1}, models.Values(metrics))
+
+	settings.Agent.Exec = []config.ExecConfig{{Name: "hang", Command: "testdata/hang.sh", Timeout: 100 * time.Millisecond}}
+	collector, err = NewExec(settings)
+	require.NoError(t, err)
+
+	started := time.Now()
+	metrics, err = collector.Collect(context.Background())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Empty(t, metrics)
+	assert.Less(t, time.Since(started), 5*time.Second)
+
+	_, err = NewExec(config.Config{Agent: config.AgentConfig{Exec: []config.ExecConfig{{Name: "empty"}}}})
+	assert.Error(t, err)
+}
+
+func TestScrape(t *testing.T) {
+	requests := 10
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "# TYPE requests_total counter\nrequests_total{code=\"200\"} %d\n", requests)
+		fmt.Fprint(w, "# TYPE queue gauge\nqueue 4\ngo_goroutines 8\n")
+	}))
+	defer server.Close()
+
+	settings := config.Config{Agent: config.AgentConfig{Scrape: []config.ScrapeConfig{{
+		Name:    "billing",
+		URL:     server.URL,
+		Metrics: config.FilterConfig{Exclude: []string{"^go_"}},
+	}}}}
+	collector, err := NewScrape(settings)
+	require.NoError(t, err)
+
+	metrics, err := collector.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"billing_queue": 4}, models.Values(metrics), "counter baseline")
+
+	requests = 25
+	metrics, err = collector.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"billing_queue": 4, "billing_requests_total_code_200": 15}, models.Values(metrics))
+
+	requests = 5
+	metrics, err = collector.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"billing_queue": 4}, models.Values(metrics), "counter reset")
+
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+
+	settings.Agent.Scrape[0].URL = unavailable.URL
+	collector, err = NewScrape(settings)
+	require.NoError(t, err)
+	_, err = collector.Collect(context.Background())
+	assert.Error(t, err)
+}
@@ -0,0 +1,76 @@
+package collector
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+
+	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/models"
+)
+
+// CPU collects per core and total CPU utilization with user, system, iowait and steal breakdown.
+// Utilization is calculated from CPU times since the previous poll, so collection never blocks
+type CPU struct {
+	times    func(context.Context, bool) ([]cpu.TimesStat, error)
+	previous map[string]cpu.TimesStat
+}
+
+// NewCPU creates CPU collector
+func NewCPU(config.Config) (Collector, error) {
+	return &CPU{times: cpu.TimesWithContext, previous: map[string]cpu.TimesStat{}}, nil
+}
+
+// Collect CPU metrics, the first poll only takes snapshot
+func (c *CPU) Collect(ctx context.Context) ([]models.Metric, error) {
+	cores, err := c.times(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := c.times(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []models.Metric
+	for i, current := range cores {
+		result = append(result, c.utilization(current, strconv.Itoa(i))...)
+	}
+	for _, current := range total {
+		result = append(result, c.utilization(current, "")...)
+	}
+	return result, nil
+}
+
+// utilization of CPU since the previous snapshot, metric names are suffixed with core number
+func (c *CPU) utilization(current cpu.TimesStat, core string) []models.Metric {
+	key := "total" + core
+	last, isOk := c.previous[key]
+	c.previous[key] = current
+	if !isOk {
+		return nil
+	}
+
+	elapsed := current.Total() - last.Total()
+	if elapsed <= 0 {
+		return nil
+	}
+
+	percent := func(before, after float64) float64 {
+		if after < before {
+			return 0
+		}
+		return (after - before) / elapsed * 100
+	}
+
+	idle := percent(last.Idle+last.Iowait, current.Idle+current.Iowait)
+	return []models.Metric{
+		models.Gauge("CPUutilization"+core, 100-idle),
+		models.Gauge("CPUuser"+core, percent(last.User+last.Nice, current.User+current.Nice)),
+		models.Gauge("CPUsystem"+core, percent(last.System+last.Irq+last.Softirq, current.System+current.Irq+current.Softirq)),
+		models.Gauge("CPUiowait"+core, percent(last.Iowait, current.Iowait)),
+		models.Gauge("CPUsteal"+core, percent(last.Steal, current.Steal)),
+	}
+}
@@ -0,0 +1,128 @@
+package collector
+
+import (
+	"context"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+
+	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/models"
+)
+
+// Disk collects per mount filesystem usage and per device I/O rates between polls
+type Disk struct {
+	partitions func(context.Context, bool) ([]disk.PartitionStat, error)
+	usage      func(context.Context, string) (*disk.UsageStat, error)
+	ioCounters func(context.Context, ...string) (map[string]disk.IOCountersStat, error)
+	now        func() time.Time
+	mounts     filter
+	devices    filter
+	previous   map[string]disk.IOCountersStat
+	polled     time.Time
+}
+
+// NewDisk creates disk collector
+func NewDisk(settings config.Config) (Collector, error) {
+	mounts, err := newFilter(settings.Agent.Disk.Mounts)
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := newFilter(settings.Agent.Disk.Devices)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Disk{
+		partitions: disk.PartitionsWithContext,
+		usage:      disk.UsageWithContext,
+		ioCounters: disk.IOCountersWithContext,
+		now:        time.Now,
+		mounts:     mounts,
+		devices:    devices,
+	}, nil
+}
+
+// Collect disk metrics, mounts failed to stat are skipped and the last error is returned
+func (d *Disk) Collect(ctx context.Context) ([]models.Metric, error) {
+	result, lastErr := d.collectUsage(ctx)
+
+	rates, err := d.collectRates(ctx)
+	if err != nil {
+		lastErr = err
+	}
+	return append(result, rates...), lastErr
+}
+
+func (d *Disk) collectUsage(ctx context.Context) ([]models.Metric, error) {
+	partitions, err := d.partitions(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []models.Metric
+	var lastErr error
+	for _, partition := range partitions {
+		if !d.mounts.match(partition.Mountpoint) {
+			continue
+		}
+
+		stat, err := d.usage(ctx, partition.Mountpoint)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		name := suffix(partition.Mountpoint)
+		result = append(result,
+			models.Gauge("DiskTotal_"+name, float64(stat.Total)),
+			models.Gauge("DiskUsed_"+name, float64(stat.Used)),
+			models.Gauge("DiskFree_"+name, float64(stat.Free)),
+			models.Gauge("DiskUsedPercent_"+name, stat.UsedPercent),
+			models.Gauge("DiskInodesUsed_"+name, float64(stat.InodesUsed)),
+			models.Gauge("DiskInodesFree_"+name, float64(stat.InodesFree)),
+			models.Gauge("DiskInodesUsedPercent_"+name, stat.InodesUsedPercent),
+		)
+	}
+	return result, lastErr
+}
+
+func (d *Disk) collectRates(ctx context.Context) ([]models.Metric, error) {
+	counters, err := d.ioCounters(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := d.now()
+	previous, polled := d.previous, d.polled
+	d.previous, d.polled = counters, now
+
+	seconds := now.Sub(polled).Seconds()
+	if previous == nil || seconds <= 0 {
+		return nil, nil
+	}
+
+	var result []models.Metric
+	for device, current := range counters {
+		last, isOk := previous[device]
+		if !isOk || !d.devices.match(device) {
+			continue
+		}
+
+		name := suffix(device)
+		result = appendRate(result, "DiskReadBytesRate_"+name, last.ReadBytes, current.ReadBytes, seconds)
+		result = appendRate(result, "DiskWriteBytesRate_"+name, last.WriteBytes, current.WriteBytes, seconds)
+		result = appendRate(result, "DiskReadOpsRate_"+name, last.ReadCount, current.ReadCount, seconds)
+		result = appendRate(result, "DiskWriteOpsRate_"+name, last.WriteCount, current.WriteCount, seconds)
+	}
+	return result, nil
+}
+
+// appendRate appends per second rate of counter, counter reset is skipped
+func appendRate(metrics []models.Metric, name string, previous, current uint64, seconds float64) []models.Metric {
+	if current < previous {
+		return metrics
+	}
+	return append(metrics, models.Gauge(name, float64(current-previous)/seconds))
+}
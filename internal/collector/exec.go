@@ -0,0 +1,200 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/models"
+)
+
+const defaultExecTimeout = 10 * time.Second
+
+// execScript configured executable with time of its last run
+type execScript struct {
+	settings config.ExecConfig
+	timeout  time.Duration
+	last     time.Time
+}
+
+// Exec runs configured executables and parses metrics of their stdout.
+// Output is either JSON metric list or "name type value" lines, type is gauge or counter
+type Exec struct {
+	scripts []*execScript
+	now     func() time.Time
+}
+
+// NewExec creates exec collector
+func NewExec(settings config.Config) (Collector, error) {
+	var scripts []*execScript
+	for _, entry := range settings.Agent.Exec {
+		if entry.Name == "" || entry.Command == "" {
+			return nil, errors.New("exec entry requires name and command")
+		}
+
+		timeout := entry.Timeout
+		if timeout <= 0 {
+			timeout = defaultExecTimeout
+		}
+		scripts = append(scripts, &execScript{settings: entry, timeout: timeout})
+	}
+	return &Exec{scripts: scripts, now: time.Now}, nil
+}
+
+// Collect runs due executables concurrently, executable without interval runs every poll
+func (e *Exec) Collect(ctx context.Context) ([]models.Metric, error) {
+	now := e.now()
+	var result []models.Metric
+	var lastErr error
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, script := range e.scripts {
+		if !script.last.IsZero() && now.Sub(script.last) < script.settings.Interval {
+			continue
+		}
+		script.last = now
+
+		wg.Add(1)
+		go func(script *execScript) {
+			defer wg.Done()
+			metrics, err := script.collect(ctx)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			result = append(result, metrics...)
+			if err != nil {
+				lastErr = fmt.Errorf("exec %s: %w", script.settings.Name, err)
+			}
+		}(script)
+	}
+	wg.Wait()
+	return result, lastErr
+}
+
+// collect runs executable, metrics printed before failure are kept
+func (s *execScript) collect(ctx context.Context) ([]models.Metric, error) {
+	output, runErr := s.run(ctx)
+	metrics, err := parseExecOutput(output)
+	if runErr != nil {
+		return metrics, runErr
+	}
+	return metrics, err
+}
+
+// run executable in its own process group, the whole group is killed on timeout
+func (s *execScript) run(ctx context.Context) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(s.settings.Command, s.settings.Args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			if message := strings.TrimSpace(stderr.String()); message != "" {
+				err = fmt.Errorf("%w: %s", err, message)
+			}
+		}
+		return stdout.Bytes(), err
+	case <-ctx.Done():
+		// process is always reaped, it is killed directly when its group can not be killed
+		err := killProcessGroup(cmd)
+		if err != nil {
+			_ = cmd.Process.Kill()
+		}
+		<-done
+		if err != nil {
+			return nil, err
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// parseExecOutput parses JSON metric list or "name type value" lines, empty and # lines are skipped.
+// Invalid metrics are skipped, the last error is returned
+func parseExecOutput(output []byte) ([]models.Metric, error) {
+	trimmed := bytes.TrimSpace(output)
+	if len(trimmed) == 0 {
+		return nil, nil
+	}
+
+	var metrics []models.Metric
+	var lastErr error
+	if trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &metrics); err != nil {
+			return nil, err
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			metric, err := parseExecLine(line)
+			if err != nil {
+				lastErr = fmt.Errorf("%q: %w", line, err)
+				continue
+			}
+			metrics = append(metrics, metric)
+		}
+		if err := scanner.Err(); err != nil {
+			lastErr = err
+		}
+	}
+
+	result := make([]models.Metric, 0, len(metrics))
+	for _, metric := range metrics {
+		if err := metric.Check(); err != nil {
+			lastErr = fmt.Errorf("%s: %w", metric.Name, err)
+			continue
+		}
+		result = append(result, metric)
+	}
+	return result, lastErr
+}
+
+func parseExecLine(line string) (models.Metric, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return models.Metric{}, errors.New("expected name type value")
+	}
+
+	switch fields[1] {
+	case models.GaugeName:
+		value, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return models.Metric{}, err
+		}
+		return models.Gauge(fields[0], value), nil
+	case models.CounterName:
+		delta, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			return models.Metric{}, err
+		}
+		return models.Counter(fields[0], delta), nil
+	}
+	return models.Metric{}, fmt.Errorf("unknown metric type %q", fields[1])
+}
@@ -0,0 +1,11 @@
+package collector
+
+import (
+	"os/exec"
+)
+
+func setProcessGroup(*exec.Cmd) {}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,69 @@
+package collector
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/syols/go-devops/config"
+)
+
+// filter matches names by include and exclude patterns, empty include matches every name
+type filter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+func newFilter(settings config.FilterConfig) (filter, error) {
+	include, err := compile(settings.Include)
+	if err != nil {
+		return filter{}, err
+	}
+
+	exclude, err := compile(settings.Exclude)
+	if err != nil {
+		return filter{}, err
+	}
+	return filter{include: include, exclude: exclude}, nil
+}
+
+func (f filter) match(name string) bool {
+	for _, pattern := range f.exclude {
+		if pattern.MatchString(name) {
+			return false
+		}
+	}
+
+	if len(f.include) == 0 {
+		return true
+	}
+
+	for _, pattern := range f.include {
+		if pattern.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func compile(patterns []string) ([]*regexp.Regexp, error) {
+	result := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, compiled)
+	}
+	return result, nil
+}
+
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// suffix converts mount point or device name to metric name suffix, "/" is "rootfs" to differ from "/root"
+func suffix(name string) string {
+	name = strings.Trim(unsafeName.ReplaceAllString(name, "_"), "_")
+	if name == "" {
+		return "rootfs"
+	}
+	return name
+}
@@ -0,0 +1,34 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/shirou/gopsutil/v3/load"
+
+	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/models"
+)
+
+// Load collects host load average
+type Load struct {
+	avg func(context.Context) (*load.AvgStat, error)
+}
+
+// NewLoad creates load average collector
+func NewLoad(config.Config) (Collector, error) {
+	return &Load{avg: load.AvgWithContext}, nil
+}
+
+// Collect load average metrics
+func (l *Load) Collect(ctx context.Context) ([]models.Metric, error) {
+	stat, err := l.avg(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return []models.Metric{
+		models.Gauge("Load1", stat.Load1),
+		models.Gauge("Load5", stat.Load5),
+		models.Gauge("Load15", stat.Load15),
+	}, nil
+}
@@ -0,0 +1,36 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/shirou/gopsutil/v3/mem"
+
+	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/models"
+)
+
+// Memory collects host virtual memory usage
+type Memory struct {
+	virtualMemory func(context.Context) (*mem.VirtualMemoryStat, error)
+}
+
+// NewMemory creates memory collector
+func NewMemory(config.Config) (Collector, error) {
+	return &Memory{virtualMemory: mem.VirtualMemoryWithContext}, nil
+}
+
+// Collect memory metrics
+func (m *Memory) Collect(ctx context.Context) ([]models.Metric, error) {
+	stat, err := m.virtualMemory(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return []models.Metric{
+		models.Gauge("TotalMemory", float64(stat.Total)),
+		models.Gauge("FreeMemory", float64(stat.Free)),
+		models.Gauge("AvailableMemory", float64(stat.Available)),
+		models.Gauge("UsedMemory", float64(stat.Used)),
+		models.Gauge("UsedMemoryPercent", stat.UsedPercent),
+	}, nil
+}
@@ -0,0 +1,128 @@
+package collector
+
+import (
+	"context"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/net"
+
+	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/models"
+)
+
+// tcpStates reported even without connections so gauges of closed states drop to zero
+var tcpStates = []string{
+	"ESTABLISHED", "SYN_SENT", "SYN_RECV", "FIN_WAIT1", "FIN_WAIT2", "TIME_WAIT",
+	"CLOSE", "CLOSE_WAIT", "LAST_ACK", "LISTEN", "CLOSING",
+}
+
+var interfaceFields = []struct {
+	name  string
+	value func(net.IOCountersStat) uint64
+}{
+	{"NetworkBytesSent", func(s net.IOCountersStat) uint64 { return s.BytesSent }},
+	{"NetworkBytesRecv", func(s net.IOCountersStat) uint64 { return s.BytesRecv }},
+	{"NetworkPacketsSent", func(s net.IOCountersStat) uint64 { return s.PacketsSent }},
+	{"NetworkPacketsRecv", func(s net.IOCountersStat) uint64 { return s.PacketsRecv }},
+	{"NetworkErrorsIn", func(s net.IOCountersStat) uint64 { return s.Errin }},
+	{"NetworkErrorsOut", func(s net.IOCountersStat) uint64 { return s.Errout }},
+	{"NetworkDropsIn", func(s net.IOCountersStat) uint64 { return s.Dropin }},
+	{"NetworkDropsOut", func(s net.IOCountersStat) uint64 { return s.Dropout }},
+}
+
+// Network collects per interface traffic as counter deltas and rates between polls, and TCP connection states
+type Network struct {
+	counters    func(context.Context, bool) ([]net.IOCountersStat, error)
+	connections func(context.Context, string) ([]net.ConnectionStat, error)
+	now         func() time.Time
+	interfaces  filter
+	previous    map[string]net.IOCountersStat
+	polled      time.Time
+}
+
+// NewNetwork creates network collector
+func NewNetwork(settings config.Config) (Collector, error) {
+	interfaces, err := newFilter(settings.Agent.Network.Interfaces)
+	if err != nil {
+		return nil, err
+	}
+
+	network := Network{
+		counters:   net.IOCountersWithContext,
+		now:        time.Now,
+		interfaces: interfaces,
+	}
+	if !settings.Agent.Network.DisableConnections {
+		network.connections = net.ConnectionsWithoutUidsWithContext
+	}
+	return &network, nil
+}
+
+// Collect network metrics
+func (n *Network) Collect(ctx context.Context) ([]models.Metric, error) {
+	result, err := n.collectInterfaces(ctx)
+	if err != nil || n.connections == nil {
+		return result, err
+	}
+
+	states, err := n.collectStates(ctx)
+	return append(result, states...), err
+}
+
+func (n *Network) collectInterfaces(ctx context.Context) ([]models.Metric, error) {
+	stats, err := n.counters(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	now := n.now()
+	previous, polled := n.previous, n.polled
+	n.previous, n.polled = map[string]net.IOCountersStat{}, now
+	for _, stat := range stats {
+		n.previous[stat.Name] = stat
+	}
+
+	seconds := now.Sub(polled).Seconds()
+	if previous == nil || seconds <= 0 {
+		return nil, nil
+	}
+
+	var result []models.Metric
+	for _, current := range stats {
+		last, isOk := previous[current.Name]
+		if !isOk || !n.interfaces.match(current.Name) {
+			continue
+		}
+
+		name := suffix(current.Name)
+		for _, field := range interfaceFields {
+			before, after := field.value(last), field.value(current)
+			if after < before {
+				continue
+			}
+			result = append(result,
+				models.Counter(field.name+"_"+name, after-before),
+				models.Gauge(field.name+"Rate_"+name, float64(after-before)/seconds),
+			)
+		}
+	}
+	return result, nil
+}
+
+func (n *Network) collectStates(ctx context.Context) ([]models.Metric, error) {
+	connections, err := n.connections(ctx, "tcp")
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int{}
+	for _, connection := range connections {
+		counts[connection.Status]++
+	}
+
+	result := make([]models.Metric, 0, len(tcpStates))
+	for _, state := range tcpStates {
+		result = append(result, models.Gauge("TCPConnections_"+state, float64(counts[state])))
+	}
+	return result, nil
+}
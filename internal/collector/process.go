@@ -0,0 +1,245 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/process"
+
+	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/models"
+)
+
+// processInfo process statistics source, implemented by gopsutil process
+type processInfo interface {
+	NameWithContext(context.Context) (string, error)
+	CmdlineWithContext(context.Context) (string, error)
+	CreateTimeWithContext(context.Context) (int64, error)
+	MemoryInfoWithContext(context.Context) (*process.MemoryInfoStat, error)
+	TimesWithContext(context.Context) (*cpu.TimesStat, error)
+	NumFDsWithContext(context.Context) (int32, error)
+	NumThreadsWithContext(context.Context) (int32, error)
+}
+
+// processMatcher selects processes of one config entry
+type processMatcher struct {
+	name        string
+	processName string
+	pidfile     string
+	cmdline     *regexp.Regexp
+}
+
+// processSample CPU time of process instance, pid and create time identify restarted process
+type processSample struct {
+	key  string
+	cpu  float64
+	time time.Time
+}
+
+// Process collects RSS, CPU percent, open files, threads and uptime of selected processes.
+// Matching PIDs are resolved every poll, metrics of several matching processes are summed
+type Process struct {
+	pids     func(context.Context) ([]int32, error)
+	open     func(context.Context, int32) (processInfo, error)
+	readFile func(string) ([]byte, error)
+	now      func() time.Time
+	matchers []processMatcher
+	previous map[int32]processSample
+}
+
+// NewProcess creates process collector
+func NewProcess(settings config.Config) (Collector, error) {
+	var matchers []processMatcher
+	for _, entry := range settings.Agent.Processes {
+		matcher, err := newProcessMatcher(entry)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, matcher)
+	}
+
+	return &Process{
+		pids: process.PidsWithContext,
+		open: func(ctx context.Context, pid int32) (processInfo, error) {
+			return process.NewProcessWithContext(ctx, pid)
+		},
+		readFile: os.ReadFile,
+		now:      time.Now,
+		matchers: matchers,
+		previous: map[int32]processSample{},
+	}, nil
+}
+
+func newProcessMatcher(settings config.ProcessConfig) (processMatcher, error) {
+	if settings.Name == "" {
+		return processMatcher{}, errors.New("empty process name")
+	}
+
+	matcher := processMatcher{name: suffix(settings.Name), processName: settings.ProcessName, pidfile: settings.Pidfile}
+	criteria := 0
+	for _, value := range []string{settings.ProcessName, settings.Pidfile, settings.Cmdline} {
+		if value != "" {
+			criteria++
+		}
+	}
+	if criteria != 1 {
+		return processMatcher{}, fmt.Errorf("process %s: exactly one of process_name, pidfile, cmdline is required", settings.Name)
+	}
+
+	if settings.Cmdline != "" {
+		cmdline, err := regexp.Compile(settings.Cmdline)
+		if err != nil {
+			return processMatcher{}, err
+		}
+		matcher.cmdline = cmdline
+	}
+	return matcher, nil
+}
+
+// Collect metrics of selected processes
+func (p *Process) Collect(ctx context.Context) ([]models.Metric, error) {
+	if len(p.matchers) == 0 {
+		return nil, nil
+	}
+
+	pids, err := p.pids(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := p.now()
+	previous := p.previous
+	p.previous = map[int32]processSample{}
+
+	var result []models.Metric
+	var lastErr error
+	for _, matcher := range p.matchers {
+		matched, err := p.match(ctx, matcher, pids)
+		if err != nil {
+			lastErr = err
+		}
+
+		var rss, fds, threads, cpuPercent, uptime float64
+		for pid, info := range matched {
+			stats, err := p.stats(ctx, pid, info, now, previous)
+			if err != nil {
+				lastErr = err
+			}
+			rss += stats.rss
+			fds += stats.fds
+			threads += stats.threads
+			cpuPercent += stats.cpuPercent
+			if stats.uptime > uptime {
+				uptime = stats.uptime
+			}
+		}
+
+		result = append(result,
+			models.Gauge("ProcessCount_"+matcher.name, float64(len(matched))),
+			models.Gauge("ProcessRSS_"+matcher.name, rss),
+			models.Gauge("ProcessCPUPercent_"+matcher.name, cpuPercent),
+			models.Gauge("ProcessOpenFDs_"+matcher.name, fds),
+			models.Gauge("ProcessThreads_"+matcher.name, threads),
+			models.Gauge("ProcessUptime_"+matcher.name, uptime),
+		)
+	}
+	return result, lastErr
+}
+
+// match resolves processes of matcher
+func (p *Process) match(ctx context.Context, matcher processMatcher, pids []int32) (map[int32]processInfo, error) {
+	result := map[int32]processInfo{}
+	if matcher.pidfile != "" {
+		content, err := p.readFile(matcher.pidfile)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return result, nil
+			}
+			return result, err
+		}
+
+		pid, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 32)
+		if err != nil {
+			return result, fmt.Errorf("pidfile %s: %w", matcher.pidfile, err)
+		}
+
+		if info, err := p.open(ctx, int32(pid)); err == nil {
+			result[int32(pid)] = info
+		}
+		return result, nil
+	}
+
+	for _, pid := range pids {
+		info, err := p.open(ctx, pid)
+		if err != nil {
+			continue // process exited
+		}
+
+		if matcher.processName != "" {
+			if name, err := info.NameWithContext(ctx); err == nil && name == matcher.processName {
+				result[pid] = info
+			}
+			continue
+		}
+
+		if cmdline, err := info.CmdlineWithContext(ctx); err == nil && matcher.cmdline.MatchString(cmdline) {
+			result[pid] = info
+		}
+	}
+	return result, nil
+}
+
+type processStats struct {
+	rss, fds, threads, cpuPercent, uptime float64
+}
+
+// stats of process instance, CPU percent is calculated from CPU time since the previous poll
+func (p *Process) stats(ctx context.Context, pid int32, info processInfo, now time.Time, previous map[int32]processSample) (processStats, error) {
+	var result processStats
+	var lastErr error
+
+	created, err := info.CreateTimeWithContext(ctx)
+	if err != nil {
+		return result, err
+	}
+	result.uptime = now.Sub(time.Unix(0, created*int64(time.Millisecond))).Seconds()
+
+	if memory, err := info.MemoryInfoWithContext(ctx); err == nil {
+		result.rss = float64(memory.RSS)
+	} else {
+		lastErr = err
+	}
+
+	if fds, err := info.NumFDsWithContext(ctx); err == nil {
+		result.fds = float64(fds)
+	} else {
+		lastErr = err
+	}
+
+	if threads, err := info.NumThreadsWithContext(ctx); err == nil {
+		result.threads = float64(threads)
+	} else {
+		lastErr = err
+	}
+
+	times, err := info.TimesWithContext(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	sample := processSample{key: fmt.Sprintf("%d/%d", pid, created), cpu: times.User + times.System, time: now}
+	p.previous[pid] = sample
+	if last, isOk := previous[pid]; isOk && last.key == sample.key {
+		if seconds := now.Sub(last.time).Seconds(); seconds > 0 && sample.cpu >= last.cpu {
+			result.cpuPercent = (sample.cpu - last.cpu) / seconds * 100
+		}
+	}
+	return result, lastErr
+}
@@ -0,0 +1,34 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/shirou/gopsutil/v3/load"
+
+	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/models"
+)
+
+// Processes collects host process counts
+type Processes struct {
+	misc func(context.Context) (*load.MiscStat, error)
+}
+
+// NewProcesses creates processes collector
+func NewProcesses(config.Config) (Collector, error) {
+	return &Processes{misc: load.MiscWithContext}, nil
+}
+
+// Collect process count metrics
+func (p *Processes) Collect(ctx context.Context) ([]models.Metric, error) {
+	stat, err := p.misc(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return []models.Metric{
+		models.Gauge("ProcessesTotal", float64(stat.ProcsTotal)),
+		models.Gauge("ProcessesRunning", float64(stat.ProcsRunning)),
+		models.Gauge("ProcessesBlocked", float64(stat.ProcsBlocked)),
+	}, nil
+}
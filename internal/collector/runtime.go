@@ -0,0 +1,64 @@
+package collector
+
+import (
+	"context"
+	"math/rand"
+	"runtime"
+
+	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/models"
+)
+
+// Runtime collects Go runtime memory statistics of the agent and PollCount
+type Runtime struct {
+	readMemStats func(*runtime.MemStats)
+	random       func() float64
+}
+
+// NewRuntime creates runtime collector
+func NewRuntime(config.Config) (Collector, error) {
+	return &Runtime{readMemStats: runtime.ReadMemStats, random: rand.Float64}, nil
+}
+
+// Collect runtime metrics
+func (r *Runtime) Collect(context.Context) ([]models.Metric, error) {
+	var stats runtime.MemStats
+	r.readMemStats(&stats)
+
+	values := map[string]float64{
+		"Alloc":         float64(stats.Alloc),
+		"BuckHashSys":   float64(stats.BuckHashSys),
+		"Frees":         float64(stats.Frees),
+		"GCCPUFraction": stats.GCCPUFraction,
+		"GCSys":         float64(stats.GCSys),
+		"HeapAlloc":     float64(stats.HeapAlloc),
+		"HeapIdle":      float64(stats.HeapIdle),
+		"HeapInuse":     float64(stats.HeapInuse),
+		"HeapObjects":   float64(stats.HeapObjects),
+		"HeapReleased":  float64(stats.HeapReleased),
+		"HeapSys":       float64(stats.HeapSys),
+		"LastGC":        float64(stats.LastGC),
+		"Lookups":       float64(stats.Lookups),
+		"MCacheInuse":   float64(stats.MCacheInuse),
+		"MCacheSys":     float64(stats.MCacheSys),
+		"MSpanInuse":    float64(stats.MSpanInuse),
+		"MSpanSys":      float64(stats.MSpanSys),
+		"Mallocs":       float64(stats.Mallocs),
+		"NextGC":        float64(stats.NextGC),
+		"NumForcedGC":   float64(stats.NumForcedGC),
+		"NumGC":         float64(stats.NumGC),
+		"OtherSys":      float64(stats.OtherSys),
+		"PauseTotalNs":  float64(stats.PauseTotalNs),
+		"StackInuse":    float64(stats.StackInuse),
+		"StackSys":      float64(stats.StackSys),
+		"Sys":           float64(stats.Sys),
+		"TotalAlloc":    float64(stats.TotalAlloc),
+		"RandomValue":   r.random(),
+	}
+
+	result := make([]models.Metric, 0, len(values)+1)
+	for name, value := range values {
+		result = append(result, models.Gauge(name, value))
+	}
+	return append(result, models.Counter("PollCount", 1)), nil
+}
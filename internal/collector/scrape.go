@@ -0,0 +1,169 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/models"
+	"github.com/syols/go-devops/internal/prometheus"
+)
+
+const (
+	defaultScrapeTimeout = 5 * time.Second
+	maxScrapeSize        = 10 << 20
+	scrapeAccept         = "text/plain;version=0.0.4"
+)
+
+// scrapeTarget configured target with cumulative counter values of its last scrape
+type scrapeTarget struct {
+	settings config.ScrapeConfig
+	prefix   string
+	timeout  time.Duration
+	metrics  filter
+	previous map[string]float64
+}
+
+// Scrape reads Prometheus text format of HTTP targets. Metric names are prefixed by target name,
+// labels are appended to the name. Counters are sent as deltas between scrapes, other samples as gauges
+type Scrape struct {
+	targets []*scrapeTarget
+	client  *http.Client
+}
+
+// NewScrape creates scrape collector
+func NewScrape(settings config.Config) (Collector, error) {
+	var targets []*scrapeTarget
+	for _, entry := range settings.Agent.Scrape {
+		if entry.Name == "" || entry.URL == "" {
+			return nil, errors.New("scrape target requires name and url")
+		}
+
+		metrics, err := newFilter(entry.Metrics)
+		if err != nil {
+			return nil, err
+		}
+
+		timeout := entry.Timeout
+		if timeout <= 0 {
+			timeout = defaultScrapeTimeout
+		}
+		targets = append(targets, &scrapeTarget{settings: entry, prefix: suffix(entry.Name), timeout: timeout, metrics: metrics})
+	}
+	return &Scrape{targets: targets, client: &http.Client{}}, nil
+}
+
+// Collect scrapes targets concurrently
+func (s *Scrape) Collect(ctx context.Context) ([]models.Metric, error) {
+	var result []models.Metric
+	var lastErr error
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, target := range s.targets {
+		wg.Add(1)
+		go func(target *scrapeTarget) {
+			defer wg.Done()
+			metrics, err := s.scrape(ctx, target)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			result = append(result, metrics...)
+			if err != nil {
+				lastErr = fmt.Errorf("scrape %s: %w", target.settings.Name, err)
+			}
+		}(target)
+	}
+	wg.Wait()
+	return result, lastErr
+}
+
+func (s *Scrape) scrape(ctx context.Context, target *scrapeTarget) ([]models.Metric, error) {
+	ctx, cancel := context.WithTimeout(ctx, target.timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target.settings.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", scrapeAccept)
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", response.Status)
+	}
+
+	samples, errs := prometheus.Parse(io.LimitReader(response.Body, maxScrapeSize))
+	var lastErr error
+	if len(errs) > 0 {
+		lastErr = errs[len(errs)-1]
+	}
+	return target.convert(samples), lastErr
+}
+
+// convert samples to metrics, the first scrape of a counter and counter resets only update its baseline
+func (t *scrapeTarget) convert(samples []prometheus.Sample) []models.Metric {
+	previous := t.previous
+	t.previous = map[string]float64{}
+
+	var result []models.Metric
+	for _, sample := range samples {
+		if !t.metrics.match(sample.Name) || math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+			continue
+		}
+
+		name := t.name(sample)
+		if !isCumulative(sample) {
+			result = append(result, models.Gauge(name, sample.Value))
+			continue
+		}
+
+		t.previous[name] = sample.Value
+		before, isOk := previous[name]
+		if !isOk || sample.Value < before {
+			continue
+		}
+		result = append(result, models.Counter(name, uint64(math.Floor(sample.Value))-uint64(math.Floor(before))))
+	}
+	return result
+}
+
+// name of metric, prefix_name_label_value with labels sorted by name
+func (t *scrapeTarget) name(sample prometheus.Sample) string {
+	labels := make([]string, 0, len(sample.Labels))
+	for label, value := range sample.Labels {
+		if value != "" {
+			labels = append(labels, label)
+		}
+	}
+	sort.Strings(labels)
+
+	parts := []string{t.prefix, suffix(sample.Name)}
+	for _, label := range labels {
+		parts = append(parts, suffix(label), suffix(sample.Labels[label]))
+	}
+	return strings.Join(parts, "_")
+}
+
+// isCumulative reports whether sample is a counter, including buckets and counts of histograms and summaries
+func isCumulative(sample prometheus.Sample) bool {
+	switch sample.Type {
+	case prometheus.CounterType:
+		return true
+	case prometheus.HistogramType, prometheus.SummaryType:
+		return strings.HasSuffix(sample.Name, "_bucket") || strings.HasSuffix(sample.Name, "_count")
+	}
+	return false
+}
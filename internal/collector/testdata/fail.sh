@@ -0,0 +1,4 @@
+#!/bin/sh
+echo "Partial gauge 1"
+echo "disk is not mounted" >&2
+exit 2
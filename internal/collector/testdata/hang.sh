@@ -0,0 +1,3 @@
+#!/bin/sh
+echo "Hang gauge 1"
+sleep 30
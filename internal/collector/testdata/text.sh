@@ -0,0 +1,5 @@
+#!/bin/sh
+# metrics of the text format
+echo "QueueLength gauge 12.5"
+echo "JobsDone counter 3"
+echo "broken line"
@@ -0,0 +1,228 @@
+package derived
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/models"
+	"github.com/syols/go-devops/internal/store"
+)
+
+// Derived metric kinds
+const (
+	RateKind          = "rate"
+	DeltaKind         = "delta"
+	MovingAverageKind = "moving_average"
+	ExpressionKind    = "expression"
+)
+
+const defaultWindow = 10
+
+type calculator interface {
+	depends(name string) bool
+	calculate(current models.Metric, now time.Time, lookup Lookup) (float64, bool)
+}
+
+// Keys returns HMAC key of tenant
+type Keys func(tenant string) *string
+
+// Engine computes derived metrics on accepted updates
+type Engine struct {
+	metrics     store.MetricsStorage
+	keys        Keys
+	settings    []config.DerivedConfig
+	calculators map[string][]calculator
+	now         func() time.Time
+	mutex       sync.Mutex
+}
+
+// NewEngine creates derived metrics engine, derived metrics are signed with tenant keys
+func NewEngine(settings []config.DerivedConfig, metrics store.MetricsStorage, keys Keys) (*Engine, error) {
+	for _, derivedSettings := range settings {
+		if _, err := newCalculator(derivedSettings); err != nil {
+			return nil, fmt.Errorf("derived metric %s: %w", derivedSettings.Name, err)
+		}
+	}
+
+	return &Engine{
+		metrics:     metrics,
+		keys:        keys,
+		settings:    settings,
+		calculators: map[string][]calculator{},
+		now:         time.Now,
+	}, nil
+}
+
+// Derived reports whether name is configured derived metric, derived metrics are read only
+func (e *Engine) Derived(name string) bool {
+	for _, derivedSettings := range e.settings {
+		if derivedSettings.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Update recalculates derived metrics of tenant which depend on current metric
+func (e *Engine) Update(_ *models.Metric, current models.Metric) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	now := e.now()
+	lookup := func(name string) (float64, bool) {
+		metric, isOk := e.metrics.Get(current.Tenant, name)
+		if !isOk || (metric.GaugeValue == nil && metric.CounterValue == nil) {
+			return 0, false
+		}
+		return metric.Float(), true
+	}
+
+	for i, calc := range e.tenantCalculators(current.Tenant) {
+		if !calc.depends(current.Name) {
+			continue
+		}
+
+		if value, isOk := calc.calculate(current, now, lookup); isOk {
+			metric := models.Metric{
+				Name:       e.settings[i].Name,
+				MetricType: models.GaugeName,
+				GaugeValue: &value,
+				Derived:    true,
+				Tenant:     current.Tenant,
+			}
+			metric.Hash = metric.CalculateHash(e.keys(current.Tenant))
+			e.metrics.Put(metric)
+		}
+	}
+}
+
+// tenantCalculators returns calculators state of tenant, settings are validated in NewEngine
+func (e *Engine) tenantCalculators(tenant string) []calculator {
+	if calculators, isOk := e.calculators[tenant]; isOk {
+		return calculators
+	}
+
+	var calculators []calculator
+	for _, derivedSettings := range e.settings {
+		calc, _ := newCalculator(derivedSettings)
+		calculators = append(calculators, calc)
+	}
+	e.calculators[tenant] = calculators
+	return calculators
+}
+
+func newCalculator(settings config.DerivedConfig) (calculator, error) {
+	switch settings.Kind {
+	case RateKind:
+		return &rate{source: settings.Source}, nil
+	case DeltaKind:
+		return &delta{source: settings.Source}, nil
+	case MovingAverageKind:
+		window := settings.Window
+		if window <= 0 {
+			window = defaultWindow
+		}
+		return &movingAverage{source: settings.Source, window: window}, nil
+	case ExpressionKind:
+		expression, err := ParseExpression(settings.Expression)
+		if err != nil {
+			return nil, err
+		}
+		return newFormula(expression), nil
+	}
+	return nil, fmt.Errorf("unknown kind %q", settings.Kind)
+}
+
+// rate per second rate of source value between updates
+type rate struct {
+	source   string
+	previous *float64
+	time     time.Time
+}
+
+func (r *rate) depends(name string) bool {
+	return name == r.source
+}
+
+func (r *rate) calculate(current models.Metric, now time.Time, _ Lookup) (float64, bool) {
+	value := current.Float()
+	previous, previousTime := r.previous, r.time
+	r.previous, r.time = &value, now
+
+	seconds := now.Sub(previousTime).Seconds()
+	if previous == nil || seconds <= 0 {
+		return 0, false
+	}
+	return (value - *previous) / seconds, true
+}
+
+// delta difference of source value between updates
+type delta struct {
+	source   string
+	previous *float64
+}
+
+func (d *delta) depends(name string) bool {
+	return name == d.source
+}
+
+func (d *delta) calculate(current models.Metric, _ time.Time, _ Lookup) (float64, bool) {
+	value := current.Float()
+	previous := d.previous
+	d.previous = &value
+
+	if previous == nil {
+		return 0, false
+	}
+	return value - *previous, true
+}
+
+// movingAverage average of last window source values
+type movingAverage struct {
+	source string
+	window int
+	values []float64
+}
+
+func (m *movingAverage) depends(name string) bool {
+	return name == m.source
+}
+
+func (m *movingAverage) calculate(current models.Metric, _ time.Time, _ Lookup) (float64, bool) {
+	m.values = append(m.values, current.Float())
+	if len(m.values) > m.window {
+		m.values = m.values[len(m.values)-m.window:]
+	}
+
+	var sum float64
+	for _, value := range m.values {
+		sum += value
+	}
+	return sum / float64(len(m.values)), true
+}
+
+// formula arithmetic expression across metrics
+type formula struct {
+	expression Expression
+	names      map[string]struct{}
+}
+
+func newFormula(expression Expression) *formula {
+	names := map[string]struct{}{}
+	for _, name := range expression.Names() {
+		names[name] = struct{}{}
+	}
+	return &formula{expression: expression, names: names}
+}
+
+func (f *formula) depends(name string) bool {
+	_, isOk := f.names[name]
+	return isOk
+}
+
+func (f *formula) calculate(_ models.Metric, _ time.Time, lookup Lookup) (float64, bool) {
+	value, err := f.expression.Eval(lookup)
+	return value, err == nil
+}
@@ -0,0 +1,118 @@
+package derived
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/models"
+	"github.com/syols/go-devops/internal/store"
+)
+
+func TestParseExpression(t *testing.T) {
+	values := map[string]float64{"HeapInuse": 30, "HeapSys": 60}
+	lookup := func(name string) (float64, bool) {
+		value, isOk := values[name]
+		return value, isOk
+	}
+
+	tests := map[string]float64{
+		"HeapInuse / HeapSys":           0.5,
+		"(HeapSys - HeapInuse) * 2 + 1": 61,
+		"-HeapInuse + 1.5":              -28.5,
+		"100 * HeapInuse / HeapSys":     50,
+	}
+	for source, expected := range tests {
+		expression, err := ParseExpression(source)
+		require.NoError(t, err, source)
+		value, err := expression.Eval(lookup)
+		require.NoError(t, err, source)
+		assert.Equal(t, expected, value, source)
+	}
+
+	for _, source := range []string{"", "HeapInuse /", "(HeapInuse", "HeapInuse $ 2"} {
+		_, err := ParseExpression(source)
+		assert.Error(t, err, source)
+	}
+
+	expression, err := ParseExpression("HeapInuse / Unknown")
+	require.NoError(t, err)
+	_, err = expression.Eval(lookup)
+	assert.Error(t, err)
+}
+
+func TestEngine(t *testing.T) {
+	storage := store.NewMetrics(nil, nil)
+	engine, err := NewEngine([]config.DerivedConfig{
+		{Name: "PollCountRate", Kind: RateKind, Source: "PollCount"},
+		{Name: "NumGCDelta", Kind: DeltaKind, Source: "NumGC"},
+		{Name: "AllocAverage", Kind: MovingAverageKind, Source: "Alloc", Window: 2},
+		{Name: "HeapUsage", Kind: ExpressionKind, Expression: "HeapInuse / HeapSys"},
+	}, storage, func(string) *string { return nil })
+	require.NoError(t, err)
+	storage.AddHook(engine.Update)
+	assert.True(t, engine.Derived("PollCountRate"))
+	assert.False(t, engine.Derived("PollCount"))
+
+	now := time.Now()
+	engine.now = func() time.Time { return now }
+	storage.Set(models.Counter("PollCount", 10))
+	storage.Set(models.Gauge("NumGC", 3))
+	storage.Set(models.Gauge("Alloc", 1))
+	storage.Set(models.Gauge("HeapInuse", 30))
+	_, isOk := storage.Metrics["PollCountRate"]
+	assert.False(t, isOk)
+	_, isOk = storage.Metrics["HeapUsage"]
+	assert.False(t, isOk)
+
+	now = now.Add(2 * time.Second)
+	storage.Set(models.Counter("PollCount", 30))
+	storage.Set(models.Gauge("NumGC", 7))
+	storage.Set(models.Gauge("Alloc", 3))
+	storage.Set(models.Gauge("Alloc", 5))
+	storage.Set(models.Gauge("HeapSys", 60))
+
+	expected := map[string]float64{
+		"PollCountRate": 10,
+		"NumGCDelta":    4,
+		"AllocAverage":  4,
+		"HeapUsage":     0.5,
+	}
+	for name, value := range expected {
+		metric, isOk := storage.Metrics[name]
+		require.True(t, isOk, name)
+		assert.True(t, metric.Derived, name)
+		assert.Equal(t, value, *metric.GaugeValue, name)
+	}
+}
+
+func TestEngineUnknownKind(t *testing.T) {
+	_, err := NewEngine([]config.DerivedConfig{{Name: "Some", Kind: "unknown"}}, store.NewMetrics(nil, nil), nil)
+	assert.Error(t, err)
+}
+
+func TestEngineTenantKey(t *testing.T) {
+	key := "team_key"
+	storage := store.NewMetrics(nil, nil)
+	engine, err := NewEngine([]config.DerivedConfig{{Name: "HeapUsage", Kind: ExpressionKind, Expression: "HeapInuse / HeapSys"}},
+		storage, func(tenant string) *string {
+			if tenant == "team" {
+				return &key
+			}
+			return nil
+		})
+	require.NoError(t, err)
+	storage.AddHook(engine.Update)
+
+	for _, metric := range []models.Metric{models.Gauge("HeapInuse", 30), models.Gauge("HeapSys", 60)} {
+		metric.Tenant = "team"
+		storage.Set(metric)
+	}
+
+	metric, isOk := storage.Get("team", "HeapUsage")
+	require.True(t, isOk)
+	assert.Equal(t, metric.CalculateHash(&key), metric.Hash, "derived metric is signed with tenant key")
+}
@@ -0,0 +1,216 @@
+package derived
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"unicode"
+)
+
+// Lookup returns current metric value by name
+type Lookup func(name string) (float64, bool)
+
+// Expression arithmetic expression over metrics
+type Expression interface {
+	Eval(lookup Lookup) (float64, error)
+	Names() []string
+}
+
+type number float64
+
+type reference string
+
+type binary struct {
+	operator    rune
+	left, right Expression
+}
+
+type negative struct {
+	operand Expression
+}
+
+// ParseExpression parses arithmetic expression like "HeapInuse / HeapSys"
+func ParseExpression(source string) (Expression, error) {
+	p := parser{source: []rune(source)}
+	expression, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpaces()
+	if p.position < len(p.source) {
+		return nil, fmt.Errorf("unexpected symbol %q at %d", p.source[p.position], p.position)
+	}
+	return expression, nil
+}
+
+func (n number) Eval(_ Lookup) (float64, error) {
+	return float64(n), nil
+}
+
+func (n number) Names() []string {
+	return nil
+}
+
+func (r reference) Eval(lookup Lookup) (float64, error) {
+	if value, isOk := lookup(string(r)); isOk {
+		return value, nil
+	}
+	return 0, fmt.Errorf("metric %s not found", string(r))
+}
+
+func (r reference) Names() []string {
+	return []string{string(r)}
+}
+
+func (b binary) Eval(lookup Lookup) (float64, error) {
+	left, err := b.left.Eval(lookup)
+	if err != nil {
+		return 0, err
+	}
+
+	right, err := b.right.Eval(lookup)
+	if err != nil {
+		return 0, err
+	}
+
+	switch b.operator {
+	case '+':
+		return left + right, nil
+	case '-':
+		return left - right, nil
+	case '*':
+		return left * right, nil
+	case '/':
+		if right == 0 {
+			return 0, errors.New("division by zero")
+		}
+		return left / right, nil
+	}
+	return 0, fmt.Errorf("unknown operator %q", b.operator)
+}
+
+func (b binary) Names() []string {
+	return append(b.left.Names(), b.right.Names()...)
+}
+
+func (n negative) Eval(lookup Lookup) (float64, error) {
+	value, err := n.operand.Eval(lookup)
+	return -value, err
+}
+
+func (n negative) Names() []string {
+	return n.operand.Names()
+}
+
+type parser struct {
+	source   []rune
+	position int
+}
+
+func (p *parser) parseSum() (Expression, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == '+' || p.peek() == '-' {
+		operator := p.next()
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{operator: operator, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseProduct() (Expression, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == '*' || p.peek() == '/' {
+		operator := p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{operator: operator, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Expression, error) {
+	if p.peek() == '-' {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return negative{operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Expression, error) {
+	symbol := p.peek()
+	switch {
+	case symbol == '(':
+		p.next()
+		expression, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ')' {
+			return nil, errors.New("missing closing parenthesis")
+		}
+		return expression, nil
+	case unicode.IsDigit(symbol) || symbol == '.':
+		start := p.position
+		for p.position < len(p.source) && (unicode.IsDigit(p.source[p.position]) || p.source[p.position] == '.') {
+			p.position++
+		}
+		value, err := strconv.ParseFloat(string(p.source[start:p.position]), 64)
+		if err != nil {
+			return nil, err
+		}
+		return number(value), nil
+	case unicode.IsLetter(symbol) || symbol == '_':
+		start := p.position
+		for p.position < len(p.source) && isNameSymbol(p.source[p.position]) {
+			p.position++
+		}
+		return reference(p.source[start:p.position]), nil
+	case symbol == 0:
+		return nil, errors.New("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected symbol %q at %d", symbol, p.position)
+}
+
+func (p *parser) skipSpaces() {
+	for p.position < len(p.source) && unicode.IsSpace(p.source[p.position]) {
+		p.position++
+	}
+}
+
+func (p *parser) peek() rune {
+	p.skipSpaces()
+	if p.position >= len(p.source) {
+		return 0
+	}
+	return p.source[p.position]
+}
+
+func (p *parser) next() rune {
+	symbol := p.peek()
+	if symbol != 0 {
+		p.position++
+	}
+	return symbol
+}
+
+func isNameSymbol(symbol rune) bool {
+	return unicode.IsLetter(symbol) || unicode.IsDigit(symbol) || symbol == '_'
+}
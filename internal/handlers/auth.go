@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/syols/go-devops/internal/auth"
+)
+
+// Authorize middleware. Checks bearer token has scope, disabled when no tokens are configured
+func Authorize(tokens *auth.Tokens, scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !tokens.Enabled() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token := bearerToken(r)
+			if token == "" || !tokens.Known(token) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			if !tokens.Allowed(token, scope) {
+				http.Error(w, "insufficient scope", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func bearerToken(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
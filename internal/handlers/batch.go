@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/syols/go-devops/internal/models"
+)
+
+const batchTTL = time.Hour
+
+// Batches remembers responses of applied batch updates, so retried batches are not applied twice
+type Batches struct {
+	responses map[string]*batchResponse
+	swept     time.Time
+	now       func() time.Time
+	mutex     sync.Mutex
+}
+
+type batchResponse struct {
+	done    chan struct{}
+	applied bool
+	status  int
+	body    []byte
+	expires time.Time
+}
+
+// NewBatches creates batch responses cache
+func NewBatches() *Batches {
+	return &Batches{
+		responses: map[string]*batchResponse{},
+		now:       time.Now,
+	}
+}
+
+// begin returns cached response of batch, reports whether caller owns the batch and has to apply it
+func (b *Batches) begin(key string) (*batchResponse, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := b.now()
+	if now.Sub(b.swept) > batchTTL {
+		for cached, response := range b.responses {
+			if response.applied && response.expires.Before(now) {
+				delete(b.responses, cached)
+			}
+		}
+		b.swept = now
+	}
+
+	if response, isOk := b.responses[key]; isOk {
+		return response, false
+	}
+
+	response := &batchResponse{done: make(chan struct{})}
+	b.responses[key] = response
+	return response, true
+}
+
+// finish stores response of applied batch, failed batch is forgotten and can be applied by retry
+func (b *Batches) finish(key string, response *batchResponse, status int, body []byte) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if status >= 200 && status < 300 {
+		response.applied = true
+		response.status = status
+		response.body = body
+		response.expires = b.now().Add(batchTTL)
+	} else {
+		delete(b.responses, key)
+	}
+	close(response.done)
+}
+
+// Idempotent middleware. Applies batch with X-Batch-ID once per tenant, retries get response of the first attempt.
+// Concurrent retry waits until the first attempt is finished.
+func Idempotent(batches *Batches) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(models.BatchIDHeader)
+			if id == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := TenantFromContext(r.Context()) + "/" + id
+			for {
+				response, owner := batches.begin(key)
+				if owner {
+					writer := &bufferedWriter{ResponseWriter: w, status: http.StatusOK}
+					next.ServeHTTP(writer, r)
+					batches.finish(key, response, writer.status, writer.buffer.Bytes())
+					writeResponse(w, writer.status, writer.buffer.Bytes())
+					return
+				}
+
+				select {
+				case <-response.done:
+				case <-r.Context().Done():
+					return
+				}
+
+				if response.applied {
+					writeResponse(w, response.status, response.body)
+					return
+				}
+			}
+		})
+	}
+}
+
+func writeResponse(w http.ResponseWriter, status int, body []byte) {
+	w.WriteHeader(status)
+	if _, err := w.Write(body); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/syols/go-devops/internal/history"
+	"github.com/syols/go-devops/internal/store"
+)
+
+// History godoc
+// @Tags History
+// @Summary Request metric history
+// @Produce json
+// @Param type path string true "Metric type"
+// @Param name path string true "Metric name"
+// @Param resolution query string false "Resolution: raw, 1m, 1h"
+// @Param from query string false "Start time in RFC3339"
+// @Param to query string false "End time in RFC3339"
+// @Success 200 {object} []Point
+// @Failure 400 {string} string "StatusBadRequest"
+// @Failure 404 {string} string "StatusNotFound"
+// @Failure 501 {string} string "StatusNotImplemented"
+// @Router /history/{type}/{name} [get]
+func History(metrics store.MetricsStorage, samples history.History) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		metricType := chi.URLParam(r, "type")
+		metricName := chi.URLParam(r, "name")
+
+		value, isOk := metrics.Get(TenantFromContext(r.Context()), metricName)
+		if !isOk {
+			http.Error(w, "value not found", http.StatusNotFound)
+			return
+		}
+
+		if value.MetricType != metricType {
+			http.Error(w, "wrong type name", http.StatusNotImplemented)
+			return
+		}
+
+		resolution, err := history.ParseResolution(r.URL.Query().Get("resolution"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		from, err := parseTime(r.URL.Query().Get("from"), time.Time{})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		to, err := parseTime(r.URL.Query().Get("to"), time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		points, err := samples.Points(r.Context(), value.Key(), resolution, from, to)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if points == nil {
+			points = []history.Point{}
+		}
+
+		w.Header().Set("Content-Type", ContentType)
+		encoder := json.NewEncoder(w)
+		if err := encoder.Encode(points); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func parseTime(value string, defaultValue time.Time) (time.Time, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
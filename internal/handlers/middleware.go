@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"bytes"
 	"compress/gzip"
 	"context"
 	"io"
@@ -9,43 +10,149 @@ import (
 	"strings"
 	"time"
 
+	"github.com/syols/go-devops/config"
 	"github.com/syols/go-devops/internal/store"
 )
 
-type gzipWriter struct {
+const ContentType = "application/json"
+
+const maxDecompressedSize = 32 << 20
+
+var compressibleTypes = []string{"text/", "application/json", "application/javascript", "application/xml", "image/svg+xml"}
+
+// compressWriter compresses response when its content type is compressible.
+// Decision is postponed until content type is known, it is sniffed from the first write when not set
+type compressWriter struct {
 	http.ResponseWriter
-	Writer io.Writer
+	level   int
+	gz      *gzip.Writer
+	status  int
+	decided bool
 }
 
-func (w gzipWriter) Write(b []byte) (int, error) {
-	return w.Writer.Write(b)
+func (w *compressWriter) WriteHeader(status int) {
+	if w.decided {
+		return
+	}
+
+	w.status = status
+	if w.Header().Get("Content-Type") != "" {
+		w.decide()
+	}
 }
 
-const ContentType = "application/json"
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.decide()
+	}
+
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
 
-// Compress middleware. Compress payload to gzip
-func Compress(next http.Handler) http.Handler {
+func (w *compressWriter) decide() {
+	w.decided = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	if w.status != http.StatusNoContent && compressible(w.Header().Get("Content-Type")) {
+		gz, err := gzip.NewWriterLevel(w.ResponseWriter, w.level)
+		if err != nil {
+			log.Print(err)
+		} else {
+			w.gz = gz
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Header().Del("Content-Length")
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+func (w *compressWriter) Close() error {
+	if !w.decided {
+		if w.status != 0 {
+			w.ResponseWriter.WriteHeader(w.status)
+		}
+		return nil
+	}
+
+	if w.gz != nil {
+		return w.gz.Close()
+	}
+	return nil
+}
+
+func compressible(contentType string) bool {
+	for _, prefix := range compressibleTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Compress middleware. Compress response of compressible content type to gzip
+func Compress(settings config.CompressionConfig) func(http.Handler) http.Handler {
+	level := settings.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if settings.Disabled || !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Accept-Encoding")
+			writer := &compressWriter{ResponseWriter: w, level: level}
+			defer func() {
+				if err := writer.Close(); err != nil {
+					log.Print(err)
+				}
+			}()
+			next.ServeHTTP(writer, r)
+		})
+	}
+}
+
+// Decompress middleware. Decompress gzip request body
+func Decompress(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		if r.Header.Get("Content-Encoding") != "gzip" {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		gz, err := gzip.NewWriterLevel(w, gzip.NoCompression)
+		gz, err := gzip.NewReader(r.Body)
 		if err != nil {
-			log.Fatal(err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 
-		defer func(gz *gzip.Writer) {
-			err := gz.Close()
-			if err != nil {
-				log.Fatal(err)
-			}
-		}(gz)
+		body, err := io.ReadAll(io.LimitReader(gz, maxDecompressedSize+1))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if len(body) > maxDecompressedSize {
+			http.Error(w, "decompressed body is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
 
-		w.Header().Set("Content-Encoding", "gzip")
-		w.Header().Add("Content-Type", "application/json")
-		next.ServeHTTP(gzipWriter{ResponseWriter: w, Writer: gz}, r)
+		r.Header.Del("Content-Encoding")
+		r.Header.Del("Content-Length")
+		r.ContentLength = int64(len(body))
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, r)
 	})
 }
 
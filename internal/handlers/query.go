@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/syols/go-devops/internal/history"
+	"github.com/syols/go-devops/internal/query"
+)
+
+// Query godoc
+// @Tags Query
+// @Summary Evaluate metrics query
+// @Produce json
+// @Param q query string true "Query, e.g. sum by (type) (rate(PollCount[1m]))"
+// @Param time query string false "Evaluation time in RFC3339, latest values by default"
+// @Param resolution query string false "History resolution for range selectors: raw, 1m, 1h"
+// @Success 200 {object} Result
+// @Failure 400 {string} string "StatusBadRequest"
+// @Router /query [get]
+func Query(engine query.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		source := r.URL.Query().Get("q")
+		if source == "" {
+			http.Error(w, "empty query", http.StatusBadRequest)
+			return
+		}
+
+		at, err := parseTime(r.URL.Query().Get("time"), time.Time{})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resolution, err := history.ParseResolution(r.URL.Query().Get("resolution"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		result, err := engine.Query(r.Context(), TenantFromContext(r.Context()), source, at, resolution)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", ContentType)
+		encoder := json.NewEncoder(w)
+		if err := encoder.Encode(result); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
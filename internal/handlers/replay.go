@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/syols/go-devops/internal/auth"
+)
+
+type signatureVerifiedContextKey struct{}
+
+// Replay middleware. Verifies per-request signature, timestamp and nonce.
+// Unsigned requests of legacy agents pass unless tenant requires signature.
+func Replay(guard *auth.ReplayGuard, tenants Tenants) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tenant := TenantFromContext(r.Context())
+			settings := tenants[tenant]
+			key := settings.Key
+			if key == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			signature := r.Header.Get(auth.SignatureHeader)
+			if signature == "" {
+				if settings.ReplayRequired {
+					http.Error(w, "request signature required", http.StatusUnauthorized)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if verifySignature(w, r, guard, tenant, key) {
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), signatureVerifiedContextKey{}, true)))
+			}
+		})
+	}
+}
+
+// SignatureVerified reports whether request signature was verified by Replay middleware
+func SignatureVerified(ctx context.Context) bool {
+	verified, _ := ctx.Value(signatureVerifiedContextKey{}).(bool)
+	return verified
+}
+
+// verifySignature checks request signature with tenant key, responds with error on failure
+func verifySignature(w http.ResponseWriter, r *http.Request, guard *auth.ReplayGuard, tenant string, key *string) bool {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	timestamp := r.Header.Get(auth.TimestampHeader)
+	nonce := r.Header.Get(auth.NonceHeader)
+	signature := r.Header.Get(auth.SignatureHeader)
+	if err := guard.Verify(key, tenant, timestamp, nonce, signature, r.Method, r.URL.Path, body); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
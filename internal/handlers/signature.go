@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"io"
+	"net/http"
+
+	"github.com/syols/go-devops/internal/models"
+)
+
+type bodyVerifiedContextKey struct{}
+
+type bufferedWriter struct {
+	http.ResponseWriter
+	buffer bytes.Buffer
+	status int
+}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	return w.buffer.Write(b)
+}
+
+func (w *bufferedWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+// BodySignature middleware. Verifies request body hash sum before decryption and decoding,
+// signs response body with the tenant key
+func BodySignature(tenants Tenants) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := tenants.Key(TenantFromContext(r.Context()))
+			if key == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if hash := r.Header.Get(models.HashHeader); hash != "" {
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+
+				if !hmac.Equal([]byte(models.Sign(body, key)), []byte(hash)) {
+					http.Error(w, "wrong body hash sum", http.StatusBadRequest)
+					return
+				}
+				r.Body = io.NopCloser(bytes.NewReader(body))
+				r = r.WithContext(context.WithValue(r.Context(), bodyVerifiedContextKey{}, true))
+			}
+
+			writer := &bufferedWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(writer, r)
+
+			w.Header().Set(models.HashHeader, models.Sign(writer.buffer.Bytes(), key))
+			w.WriteHeader(writer.status)
+			if _, err := w.Write(writer.buffer.Bytes()); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+		})
+	}
+}
+
+// BodyVerified reports whether request body hash sum was verified by BodySignature middleware
+func BodyVerified(ctx context.Context) bool {
+	verified, _ := ctx.Value(bodyVerifiedContextKey{}).(bool)
+	return verified
+}
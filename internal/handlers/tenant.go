@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/auth"
+)
+
+// TenantHeader contains tenant ID of request
+const TenantHeader = "X-Tenant-ID"
+
+type tenantContextKey struct{}
+
+// TenantSettings namespace HMAC key and access, unsigned writes are rejected when replay protection is required
+type TenantSettings struct {
+	Key            *string
+	Public         bool
+	ReplayRequired bool
+}
+
+// Tenants maps tenant ID to its settings, empty ID is the default tenant
+type Tenants map[string]TenantSettings
+
+// NewTenants creates tenants from config. The default tenant uses server key and is public
+// for legacy agents, other tenants without key must be explicitly public
+func NewTenants(settings config.Config) (Tenants, error) {
+	tenants := Tenants{"": {Key: settings.Server.Key, Public: true, ReplayRequired: settings.Server.Replay.Required}}
+	for _, tenant := range settings.Server.Tenants {
+		if tenant.Key == nil && !tenant.Public {
+			return nil, fmt.Errorf("tenant %q has no key and is not public", tenant.ID)
+		}
+		tenants[tenant.ID] = TenantSettings{Key: tenant.Key, Public: tenant.Public, ReplayRequired: tenant.ReplayRequired}
+	}
+	return tenants, nil
+}
+
+// Key of tenant
+func (t Tenants) Key(tenant string) *string {
+	return t[tenant].Key
+}
+
+// Tenant middleware. Resolves tenant from URL prefix or header
+func Tenant(tenants Tenants) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tenant := chi.URLParam(r, "tenant")
+			if tenant == "" {
+				tenant = r.Header.Get(TenantHeader)
+			}
+
+			if _, isOk := tenants[tenant]; !isOk || strings.Contains(tenant, "/") {
+				http.Error(w, "unknown tenant", http.StatusForbidden)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), tenantContextKey{}, tenant)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// TenantFromContext returns tenant resolved by Tenant middleware
+func TenantFromContext(ctx context.Context) string {
+	if tenant, isOk := ctx.Value(tenantContextKey{}).(string); isOk {
+		return tenant
+	}
+	return ""
+}
+
+// ReadAccess middleware. Reads of private tenant require bearer token granted the tenant
+// or request signature with tenant key
+func ReadAccess(guard *auth.ReplayGuard, tokens *auth.Tokens, tenants Tenants) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tenant := TenantFromContext(r.Context())
+			settings := tenants[tenant]
+			if settings.Public || settings.Key == nil || tokens.TenantAllowed(bearerToken(r), tenant) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.Header.Get(auth.SignatureHeader) == "" {
+				http.Error(w, "tenant key or token required", http.StatusUnauthorized)
+				return
+			}
+
+			if verifySignature(w, r, guard, tenant, settings.Key) {
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
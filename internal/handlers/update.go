@@ -1,20 +1,24 @@
 package handlers
 
 import (
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/sha512"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
 
+	"github.com/syols/go-devops/internal/keyring"
 	"github.com/syols/go-devops/internal/models"
 	"github.com/syols/go-devops/internal/store"
 )
 
+var errWrongType = errors.New("wrong type name")
+
+// ReadOnly reports whether metric name is computed by server and can not be updated
+type ReadOnly func(name string) bool
+
 // Update godoc
 // @Tags Update
 // @Summary Update metric
@@ -24,16 +28,26 @@ import (
 // @Param value path float64 true "Metric value"
 // @Param name path int64 true "Metric name"
 // @Success 200 {object} Metric
+// @Failure 401 {string} string "StatusUnauthorized"
 // @Failure 500 {string} string "StatusInternalServerError"
 // @Router /update/{type}/{name}/{value} [post]
-func Update(metrics store.MetricsStorage) http.HandlerFunc {
+func Update(metrics store.MetricsStorage, tenants Tenants, readOnly ReadOnly) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		metricType := chi.URLParam(r, "type")
 		metricValue := chi.URLParam(r, "value")
 		metricName := chi.URLParam(r, "name")
 
+		// path has no hash sum, tenant with key accepts only requests with verified signature
+		tenant := TenantFromContext(r.Context())
+		key := tenants.Key(tenant)
+		if key != nil && !SignatureVerified(r.Context()) {
+			http.Error(w, "request signature required", http.StatusUnauthorized)
+			return
+		}
+
 		payload := models.NewMetric(metricName, metricType, metricValue, nil)
-		if !update(w, payload, nil, metrics) {
+		payload.Tenant = tenant
+		if !update(w, payload, key, true, readOnly, metrics) {
 			return
 		}
 
@@ -56,7 +70,7 @@ func Update(metrics store.MetricsStorage) http.HandlerFunc {
 // @Failure 422 {string} string "StatusUnprocessableEntity"
 // @Failure 500 {string} string "StatusInternalServerError"
 // @Router /update/ [post]
-func UpdateJSON(metrics store.MetricsStorage, key *string) http.HandlerFunc {
+func UpdateJSON(metrics store.MetricsStorage, tenants Tenants, readOnly ReadOnly) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Header.Get("Content-Type") != ContentType {
 			http.Error(w, "wrong content type", http.StatusUnsupportedMediaType)
@@ -70,7 +84,9 @@ func UpdateJSON(metrics store.MetricsStorage, key *string) http.HandlerFunc {
 			return
 		}
 
-		if !update(w, payload, key, metrics) {
+		tenant := TenantFromContext(r.Context())
+		payload.Tenant = tenant
+		if !update(w, payload, tenants.Key(tenant), BodyVerified(r.Context()), readOnly, metrics) {
 			return
 		}
 		encoder := json.NewEncoder(w)
@@ -87,12 +103,15 @@ func UpdateJSON(metrics store.MetricsStorage, key *string) http.HandlerFunc {
 // @Description Update metrics request
 // @Produce json
 // @Param []Metric body []Metric true "Metric list"
+// @Param X-Key-ID header string false "ID of the key used to encrypt body"
+// @Param X-Batch-ID header string false "Batch ID, retried batch is applied once"
 // @Success 200 {object} Metric
+// @Failure 400 {string} string "StatusBadRequest"
 // @Failure 415 {string} string "StatusUnsupportedMediaType"
 // @Failure 422 {string} string "StatusUnprocessableEntity"
 // @Failure 500 {string} string "StatusInternalServerError"
 // @Router /updates/ [post]
-func UpdatesJSON(metrics store.MetricsStorage, key *string, privateKey *rsa.PrivateKey) http.HandlerFunc {
+func UpdatesJSON(metrics store.MetricsStorage, tenants Tenants, keys *keyring.Keyring, readOnly ReadOnly) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Header.Get("Content-Type") != ContentType {
 			http.Error(w, "wrong content type", http.StatusUnsupportedMediaType)
@@ -102,11 +121,13 @@ func UpdatesJSON(metrics store.MetricsStorage, key *string, privateKey *rsa.Priv
 		buf, err := io.ReadAll(r.Body)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
 
-		buf, err = tryDecrypt(buf, privateKey)
+		buf, err = keys.Decrypt(r.Header.Get(keyring.KeyIDHeader), buf)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 
 		var payloads []models.Metric
@@ -115,62 +136,96 @@ func UpdatesJSON(metrics store.MetricsStorage, key *string, privateKey *rsa.Priv
 			return
 		}
 
+		// whole batch is validated first, so failed batch is not applied partially and can be retried
+		tenant := TenantFromContext(r.Context())
+		types := map[string]string{}
+		for _, payload := range payloads {
+			payload.Tenant = tenant
+			if status, err := Validate(payload, tenants.Key(tenant), BodyVerified(r.Context()), readOnly, metrics); err != nil {
+				http.Error(w, err.Error(), status)
+				return
+			}
+			if metricType, isOk := types[payload.Name]; isOk && metricType != payload.MetricType {
+				http.Error(w, errWrongType.Error(), http.StatusNotImplemented)
+				return
+			}
+			types[payload.Name] = payload.MetricType
+		}
+
 		for _, payload := range payloads {
-			if !update(w, payload, key, metrics) {
+			payload.Tenant = tenant
+			if !update(w, payload, tenants.Key(tenant), BodyVerified(r.Context()), readOnly, metrics) {
 				return
 			}
 		}
 
+		var response interface{} = payloads
+		if len(payloads) > 0 {
+			response = payloads[0]
+		}
+
 		encoder := json.NewEncoder(w)
-		if err := encoder.Encode(payloads[0]); err != nil {
+		if err := encoder.Encode(response); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 	}
 }
 
-func update(w http.ResponseWriter, payload models.Metric, key *string, metrics store.MetricsStorage) bool {
-	err := payload.Check()
-	if err, ok := err.(validator.ValidationErrors); ok {
-		if err[0].Tag() == "metric" {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return false
-		}
-		http.Error(w, err.Error(), http.StatusNotImplemented)
+func update(w http.ResponseWriter, payload models.Metric, key *string, verified bool, readOnly ReadOnly, metrics store.MetricsStorage) bool {
+	if status, err := Apply(payload, key, verified, readOnly, metrics); err != nil {
+		http.Error(w, err.Error(), status)
 		return false
 	}
+	return true
+}
 
-	hash := payload.CalculateHash(key)
-	if payload.Hash != hash {
-		http.Error(w, "wrong hash sum", http.StatusBadRequest)
-		return false
+// Apply validates metric and stores it, counter value is replaced with accepted total.
+// Returns HTTP status of the failure
+func Apply(payload models.Metric, key *string, verified bool, readOnly ReadOnly, metrics store.MetricsStorage) (int, error) {
+	if status, err := Validate(payload, key, verified, readOnly, metrics); err != nil {
+		return status, err
 	}
 
-	oldPayload, isOk := metrics.Metrics[payload.Name]
-	if isOk {
-		if payload.MetricType != oldPayload.MetricType {
-			http.Error(w, "wrong type name", http.StatusNotImplemented)
-			return false
+	err := metrics.Update(payload.Tenant, payload.Name, func(previous *models.Metric) (models.Metric, error) {
+		if previous != nil {
+			if payload.MetricType != previous.MetricType {
+				return models.Metric{}, errWrongType
+			}
+			if payload.MetricType == models.CounterName {
+				*payload.CounterValue += *previous.CounterValue
+			}
 		}
-		if payload.MetricType == models.CounterName {
-			*payload.CounterValue += *oldPayload.CounterValue
+
+		payload.Hash = payload.CalculateHash(key)
+		return payload, nil
+	})
+	if err != nil {
+		return http.StatusNotImplemented, err
+	}
+	return http.StatusOK, nil
+}
+
+// Validate checks metric before it is stored. Returns HTTP status of the failure
+func Validate(payload models.Metric, key *string, verified bool, readOnly ReadOnly, metrics store.MetricsStorage) (int, error) {
+	err := payload.Check()
+	if err, ok := err.(validator.ValidationErrors); ok {
+		if err[0].Tag() == "metric" {
+			return http.StatusBadRequest, err
 		}
+		return http.StatusNotImplemented, err
 	}
 
-	payload.Hash = payload.CalculateHash(key)
-	metrics.Metrics[payload.Name] = payload
-	return true
-}
+	if readOnly(payload.Name) {
+		return http.StatusBadRequest, errors.New("derived metric is read only")
+	}
 
-func tryDecrypt(msg []byte, key *rsa.PrivateKey) ([]byte, error) {
-	if key == nil {
-		return msg, nil
+	if !verified && payload.Hash != payload.CalculateHash(key) {
+		return http.StatusBadRequest, errors.New("wrong hash sum")
 	}
 
-	hash := sha512.New()
-	result, err := rsa.DecryptOAEP(hash, rand.Reader, key, msg, nil)
-	if err != nil {
-		return nil, err
+	if previous, isOk := metrics.Get(payload.Tenant, payload.Name); isOk && previous.MetricType != payload.MetricType {
+		return http.StatusNotImplemented, errWrongType
 	}
-	return result, nil
+	return http.StatusOK, nil
 }
@@ -26,7 +26,7 @@ func Value(metrics store.MetricsStorage) http.HandlerFunc {
 		metricType := chi.URLParam(r, "type")
 		metricName := chi.URLParam(r, "name")
 
-		value, isOk := metrics.Metrics[metricName]
+		value, isOk := metrics.Get(TenantFromContext(r.Context()), metricName)
 		if !isOk {
 			http.Error(w, "value not found", http.StatusNotFound)
 			return
@@ -55,7 +55,7 @@ func Value(metrics store.MetricsStorage) http.HandlerFunc {
 // @Failure 422 {string} string "StatusUnprocessableEntity"
 // @Failure 500 {string} string "StatusInternalServerError"
 // @Router /value/ [post]
-func ValueJSON(metrics store.MetricsStorage) http.HandlerFunc {
+func ValueJSON(metrics store.MetricsStorage, tenants Tenants) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Header.Get("Content-Type") != ContentType {
 			http.Error(w, "wrong content type", http.StatusUnsupportedMediaType)
@@ -77,7 +77,8 @@ func ValueJSON(metrics store.MetricsStorage) http.HandlerFunc {
 			}
 		}
 
-		value, isOk := metrics.Metrics[payload.Name]
+		tenant := TenantFromContext(r.Context())
+		value, isOk := metrics.Get(tenant, payload.Name)
 		if !isOk {
 			http.Error(w, "value not found", http.StatusNotFound)
 			return
@@ -88,7 +89,7 @@ func ValueJSON(metrics store.MetricsStorage) http.HandlerFunc {
 			return
 		}
 
-		value.Hash = value.CalculateHash(metrics.Key)
+		value.Hash = value.CalculateHash(tenants.Key(tenant))
 		encoder := json.NewEncoder(w)
 		if err := encoder.Encode(value); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
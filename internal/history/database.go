@@ -0,0 +1,178 @@
+package history
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/syols/go-devops/internal/store"
+)
+
+const (
+	flushInterval = time.Second
+	flushSize     = 1000
+)
+
+// DatabaseHistory struct, connection pool is kept for history lifetime.
+// Added points are buffered and written in batches by background goroutine
+type DatabaseHistory struct {
+	db          *sqlx.DB
+	retention   Retention
+	selectQuery string
+	insertQuery string
+	rollupQuery string
+	deleteQuery string
+	pending     []Point
+	full        chan struct{}
+	mutex       sync.Mutex
+}
+
+// NewDatabaseHistory creates database history and starts flushing buffered points
+func NewDatabaseHistory(connectionString string, retention Retention) (*DatabaseHistory, error) {
+	db, err := sqlx.Connect("postgres", connectionString)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(store.LoadSQL("history_create.sql")); err != nil {
+		log.Print(err)
+	}
+
+	history := &DatabaseHistory{
+		db:          db,
+		retention:   retention,
+		selectQuery: store.LoadSQL("history_select.sql"),
+		insertQuery: store.LoadSQL("history_insert.sql"),
+		rollupQuery: store.LoadSQL("history_rollup.sql"),
+		deleteQuery: store.LoadSQL("history_delete.sql"),
+		full:        make(chan struct{}, 1),
+	}
+	go history.run()
+	return history, nil
+}
+
+// Add buffers raw point, buffer is written on flush interval or when it is full
+func (d *DatabaseHistory) Add(_ context.Context, point Point) error {
+	d.mutex.Lock()
+	d.pending = append(d.pending, point)
+	full := len(d.pending) >= flushSize
+	d.mutex.Unlock()
+
+	if full {
+		select {
+		case d.full <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Flush writes buffered points in one transaction
+func (d *DatabaseHistory) Flush(ctx context.Context) error {
+	d.mutex.Lock()
+	points := d.pending
+	d.pending = nil
+	d.mutex.Unlock()
+
+	if len(points) == 0 {
+		return nil
+	}
+
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	insert, err := tx.PrepareNamedContext(ctx, d.insertQuery)
+	if err != nil {
+		return rollback(tx, err)
+	}
+	defer insert.Close()
+
+	for _, point := range points {
+		if _, err := insert.ExecContext(ctx, point); err != nil {
+			return rollback(tx, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (d *DatabaseHistory) run() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-d.full:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := d.Flush(ctx); err != nil {
+			log.Print(err)
+		}
+		cancel()
+	}
+}
+
+// Points of metric from database history aggregated to resolution, buffered points are flushed first
+func (d *DatabaseHistory) Points(ctx context.Context, name string, resolution Resolution, from, to time.Time) ([]Point, error) {
+	if err := d.Flush(ctx); err != nil {
+		return nil, err
+	}
+
+	var finer []string
+	for _, value := range resolution.Finer() {
+		finer = append(finer, string(value))
+	}
+
+	var points []Point
+	if err := d.db.SelectContext(ctx, &points, d.selectQuery, name, pq.Array(finer), from, to); err != nil {
+		return nil, err
+	}
+
+	for i := range points {
+		points[i].Avg = points[i].Sum / float64(points[i].Count)
+	}
+	return Aggregate(points, resolution), nil
+}
+
+// Rollup moves expired points into coarser resolution
+func (d *DatabaseHistory) Rollup(ctx context.Context, now time.Time) error {
+	if err := d.Flush(ctx); err != nil {
+		return err
+	}
+
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, resolution := range resolutions {
+		if d.retention[resolution] <= 0 {
+			continue
+		}
+
+		before := now.Add(-d.retention[resolution])
+		if next, isOk := resolution.next(); isOk {
+			if _, err := tx.ExecContext(ctx, d.rollupQuery, resolution, next, next.unit(), before); err != nil {
+				return rollback(tx, err)
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, d.deleteQuery, resolution, before); err != nil {
+			return rollback(tx, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func rollback(tx *sqlx.Tx, err error) error {
+	if rollbackErr := tx.Rollback(); rollbackErr != nil {
+		log.Print(rollbackErr)
+	}
+	return err
+}
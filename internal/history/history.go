@@ -0,0 +1,233 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/models"
+)
+
+// Resolution of history points
+type Resolution string
+
+// History resolutions from finest to coarsest
+const (
+	Raw    Resolution = "raw"
+	Minute Resolution = "1m"
+	Hour   Resolution = "1h"
+)
+
+const (
+	defaultRollupInterval  = time.Minute
+	defaultRawRetention    = time.Hour
+	defaultMinuteRetention = 24 * time.Hour
+)
+
+var resolutions = []Resolution{Raw, Minute, Hour}
+
+// Point aggregated metric values in time bucket
+type Point struct {
+	Name       string     `json:"-" db:"id"`
+	MetricType string     `json:"-" db:"metric_type"`
+	Resolution Resolution `json:"-" db:"resolution"`
+	Time       time.Time  `json:"time" db:"time"`
+	Min        float64    `json:"min" db:"min_value"`
+	Max        float64    `json:"max" db:"max_value"`
+	Avg        float64    `json:"avg" db:"-"`
+	Last       float64    `json:"last" db:"last_value"`
+	Sum        float64    `json:"sum" db:"sum_value"`
+	Count      uint64     `json:"count" db:"count"`
+}
+
+// History interface
+type History interface {
+	Add(ctx context.Context, point Point) error
+	Points(ctx context.Context, name string, resolution Resolution, from, to time.Time) ([]Point, error)
+	Rollup(ctx context.Context, now time.Time) error
+	Flush(ctx context.Context) error
+}
+
+// Retention of history resolutions
+type Retention map[Resolution]time.Duration
+
+// NewHistory creates history and starts rollup scheduler
+func NewHistory(settings config.Config) (History, error) {
+	retention := NewRetention(settings.Store.History)
+
+	var history History
+	if settings.Store.DatabaseConnectionString != nil {
+		databaseHistory, err := NewDatabaseHistory(*settings.Store.DatabaseConnectionString, retention)
+		if err != nil {
+			return nil, err
+		}
+		history = databaseHistory
+	} else {
+		history = NewMemoryHistory(retention)
+	}
+
+	interval := settings.Store.History.RollupInterval
+	if interval <= 0 {
+		interval = defaultRollupInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		for {
+			<-ticker.C
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			if err := history.Rollup(ctx, time.Now()); err != nil {
+				log.Print(err)
+			}
+			cancel()
+		}
+	}()
+	return history, nil
+}
+
+// NewRetention creates retention from config
+func NewRetention(settings config.HistoryConfig) Retention {
+	retention := Retention{
+		Raw:    settings.RawRetention,
+		Minute: settings.MinuteRetention,
+		Hour:   settings.HourRetention,
+	}
+	if retention[Raw] <= 0 {
+		retention[Raw] = defaultRawRetention
+	}
+	if retention[Minute] <= 0 {
+		retention[Minute] = defaultMinuteRetention
+	}
+	return retention
+}
+
+// ParseResolution parses resolution name, empty name means raw samples
+func ParseResolution(value string) (Resolution, error) {
+	if value == "" {
+		return Raw, nil
+	}
+
+	for _, resolution := range resolutions {
+		if string(resolution) == value {
+			return resolution, nil
+		}
+	}
+	return "", fmt.Errorf("unknown resolution %q", value)
+}
+
+// Duration of resolution bucket
+func (r Resolution) Duration() time.Duration {
+	switch r {
+	case Minute:
+		return time.Minute
+	case Hour:
+		return time.Hour
+	}
+	return 0
+}
+
+// unit of resolution for database date truncation
+func (r Resolution) unit() string {
+	if r == Hour {
+		return "hour"
+	}
+	return "minute"
+}
+
+// Finer returns resolutions which are not coarser than r
+func (r Resolution) Finer() []Resolution {
+	for i, resolution := range resolutions {
+		if resolution == r {
+			return resolutions[:i+1]
+		}
+	}
+	return nil
+}
+
+func (r Resolution) next() (Resolution, bool) {
+	for i, resolution := range resolutions[:len(resolutions)-1] {
+		if resolution == r {
+			return resolutions[i+1], true
+		}
+	}
+	return "", false
+}
+
+// NewPoint creates raw point from single value
+func NewPoint(name, metricType string, value float64, last float64, at time.Time) Point {
+	return Point{
+		Name:       name,
+		MetricType: metricType,
+		Resolution: Raw,
+		Time:       at,
+		Min:        value,
+		Max:        value,
+		Avg:        value,
+		Last:       last,
+		Sum:        value,
+		Count:      1,
+	}
+}
+
+// Aggregate merges points into buckets of resolution
+func Aggregate(points []Point, resolution Resolution) []Point {
+	if resolution == Raw {
+		return points
+	}
+
+	sorted := make([]Point, len(points))
+	copy(sorted, points)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+
+	var result []Point
+	for _, point := range sorted {
+		bucket := point.Time.Truncate(resolution.Duration())
+		if len(result) > 0 && result[len(result)-1].Time.Equal(bucket) {
+			result[len(result)-1] = merge(result[len(result)-1], point)
+			continue
+		}
+
+		point.Time = bucket
+		point.Resolution = resolution
+		result = append(result, point)
+	}
+	return result
+}
+
+// Recorder returns storage hook which records accepted updates.
+// Gauges are recorded as values, counters as increments.
+func Recorder(history History) func(previous *models.Metric, current models.Metric) {
+	return func(previous *models.Metric, current models.Metric) {
+		last := current.Float()
+		value := last
+		if current.MetricType == models.CounterName && previous != nil && previous.CounterValue != nil {
+			value -= float64(*previous.CounterValue)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		point := NewPoint(current.Key(), current.MetricType, value, last, time.Now())
+		if err := history.Add(ctx, point); err != nil {
+			log.Print(err)
+		}
+	}
+}
+
+func merge(left, right Point) Point {
+	if right.Min < left.Min {
+		left.Min = right.Min
+	}
+	if right.Max > left.Max {
+		left.Max = right.Max
+	}
+	left.Last = right.Last
+	left.Sum += right.Sum
+	left.Count += right.Count
+	left.Avg = left.Sum / float64(left.Count)
+	return left
+}
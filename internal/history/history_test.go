@@ -0,0 +1,97 @@
+package history
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/models"
+)
+
+func TestParseResolution(t *testing.T) {
+	resolution, err := ParseResolution("")
+	assert.NoError(t, err)
+	assert.Equal(t, Raw, resolution)
+
+	resolution, err = ParseResolution("1h")
+	assert.NoError(t, err)
+	assert.Equal(t, Hour, resolution)
+
+	_, err = ParseResolution("1d")
+	assert.Error(t, err)
+}
+
+func TestAggregate(t *testing.T) {
+	start := time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC)
+	points := []Point{
+		NewPoint("Alloc", models.GaugeName, 3, 3, start.Add(30*time.Second)),
+		NewPoint("Alloc", models.GaugeName, 1, 1, start.Add(10*time.Second)),
+		NewPoint("Alloc", models.GaugeName, 5, 5, start.Add(70*time.Second)),
+	}
+
+	result := Aggregate(points, Minute)
+	require.Len(t, result, 2)
+	assert.Equal(t, start, result[0].Time)
+	assert.Equal(t, Minute, result[0].Resolution)
+	assert.Equal(t, 1.0, result[0].Min)
+	assert.Equal(t, 3.0, result[0].Max)
+	assert.Equal(t, 2.0, result[0].Avg)
+	assert.Equal(t, 3.0, result[0].Last)
+	assert.Equal(t, uint64(2), result[0].Count)
+	assert.Equal(t, 5.0, result[1].Last)
+}
+
+func TestMemoryRollup(t *testing.T) {
+	ctx := context.Background()
+	history := NewMemoryHistory(NewRetention(config.HistoryConfig{
+		RawRetention:    time.Minute,
+		MinuteRetention: time.Hour,
+	}))
+
+	now := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		at := now.Add(-time.Duration(i) * 30 * time.Second)
+		require.NoError(t, history.Add(ctx, NewPoint("PollCount", models.CounterName, 2, 0, at)))
+	}
+	require.NoError(t, history.Rollup(ctx, now))
+
+	raw, err := history.Points(ctx, "PollCount", Raw, time.Time{}, now)
+	require.NoError(t, err)
+	assert.Len(t, raw, 3)
+
+	minutes, err := history.Points(ctx, "PollCount", Minute, time.Time{}, now)
+	require.NoError(t, err)
+	var sum float64
+	for _, point := range minutes {
+		sum += point.Sum
+	}
+	assert.Len(t, minutes, 6)
+	assert.Equal(t, 20.0, sum)
+
+	hours, err := history.Points(ctx, "PollCount", Hour, time.Time{}, now)
+	require.NoError(t, err)
+	require.Len(t, hours, 2)
+	assert.Equal(t, uint64(10), hours[0].Count+hours[1].Count)
+}
+
+func TestRecorder(t *testing.T) {
+	history := NewMemoryHistory(NewRetention(config.HistoryConfig{}))
+	record := Recorder(history)
+
+	previous := uint64(5)
+	current := uint64(8)
+	record(
+		&models.Metric{Name: "PollCount", MetricType: models.CounterName, CounterValue: &previous},
+		models.Metric{Name: "PollCount", MetricType: models.CounterName, CounterValue: &current},
+	)
+
+	points, err := history.Points(context.Background(), "PollCount", Raw, time.Time{}, time.Now())
+	require.NoError(t, err)
+	require.Len(t, points, 1)
+	assert.Equal(t, 3.0, points[0].Sum)
+	assert.Equal(t, 8.0, points[0].Last)
+}
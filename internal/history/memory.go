@@ -0,0 +1,88 @@
+package history
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type series map[Resolution][]Point
+
+// MemoryHistory struct
+type MemoryHistory struct {
+	series    map[string]series
+	retention Retention
+	mutex     sync.RWMutex
+}
+
+// NewMemoryHistory creates memory history
+func NewMemoryHistory(retention Retention) *MemoryHistory {
+	return &MemoryHistory{
+		series:    map[string]series{},
+		retention: retention,
+	}
+}
+
+// Add raw point to memory history
+func (m *MemoryHistory) Add(_ context.Context, point Point) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, isOk := m.series[point.Name]; !isOk {
+		m.series[point.Name] = series{}
+	}
+	m.series[point.Name][Raw] = append(m.series[point.Name][Raw], point)
+	return nil
+}
+
+// Flush does nothing, points are added to memory immediately
+func (m *MemoryHistory) Flush(context.Context) error {
+	return nil
+}
+
+// Points of metric from memory history aggregated to resolution
+func (m *MemoryHistory) Points(_ context.Context, name string, resolution Resolution, from, to time.Time) ([]Point, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var points []Point
+	for _, finer := range resolution.Finer() {
+		for _, point := range m.series[name][finer] {
+			if point.Time.Before(from) || point.Time.After(to) {
+				continue
+			}
+			points = append(points, point)
+		}
+	}
+	return Aggregate(points, resolution), nil
+}
+
+// Rollup moves expired points into coarser resolution
+func (m *MemoryHistory) Rollup(_ context.Context, now time.Time) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, values := range m.series {
+		for _, resolution := range resolutions {
+			expired, actual := split(values[resolution], now.Add(-m.retention[resolution]))
+			if next, isOk := resolution.next(); isOk && len(expired) > 0 {
+				values[next] = Aggregate(append(values[next], expired...), next)
+			}
+			if m.retention[resolution] > 0 {
+				values[resolution] = actual
+			}
+		}
+	}
+	return nil
+}
+
+func split(points []Point, before time.Time) (expired []Point, actual []Point) {
+	for _, point := range points {
+		if point.Time.Before(before) {
+			expired = append(expired, point)
+			continue
+		}
+		actual = append(actual, point)
+	}
+	return
+}
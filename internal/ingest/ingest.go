@@ -0,0 +1,161 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/models"
+	"github.com/syols/go-devops/internal/statsd"
+)
+
+const (
+	maxPacketSize   = 65535
+	maxBodySize     = 1 << 20
+	shutdownTimeout = 5 * time.Second
+)
+
+// Sink receives ingested metrics
+type Sink func(metrics []models.Metric)
+
+// Listener receives custom metrics of local applications over StatsD UDP and HTTP
+type Listener struct {
+	settings config.IngestConfig
+	sink     Sink
+}
+
+// NewListener creates listener struct
+func NewListener(settings config.IngestConfig, sink Sink) *Listener {
+	return &Listener{settings: settings, sink: sink}
+}
+
+// Run listens configured addresses until context is done
+func (l *Listener) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	var listeners sync.WaitGroup
+	if l.settings.StatsdAddress != nil {
+		listeners.Add(1)
+		go l.serveStatsd(ctx, *l.settings.StatsdAddress, &listeners)
+	}
+
+	if l.settings.HTTPAddress != nil {
+		listeners.Add(1)
+		go l.serveHTTP(ctx, *l.settings.HTTPAddress, &listeners)
+	}
+	listeners.Wait()
+}
+
+func (l *Listener) serveStatsd(ctx context.Context, address string, wg *sync.WaitGroup) {
+	defer wg.Done()
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+
+	go func() {
+		<-ctx.Done()
+		if err := conn.Close(); err != nil {
+			log.Print(err)
+		}
+	}()
+
+	buffer := make([]byte, maxPacketSize)
+	for {
+		n, _, err := conn.ReadFrom(buffer)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Print(err)
+			}
+			return
+		}
+		l.sink(Statsd(buffer[:n]))
+	}
+}
+
+func (l *Listener) serveHTTP(ctx context.Context, address string, wg *sync.WaitGroup) {
+	defer wg.Done()
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler(l.sink))
+	server := http.Server{Addr: address, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Print(err)
+		}
+	}()
+
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Print(err)
+	}
+}
+
+// Statsd converts StatsD gauges and counters to metrics, other lines are logged and skipped
+func Statsd(payload []byte) []models.Metric {
+	samples, errs := statsd.ParseLines(payload)
+	for _, err := range errs {
+		log.Print(err)
+	}
+
+	result := make([]models.Metric, 0, len(samples))
+	for _, sample := range samples {
+		metric, err := sample.Metric()
+		if err == nil {
+			err = metric.Check()
+		}
+		if err != nil {
+			log.Printf("%s: %s", sample.Name, err.Error())
+			continue
+		}
+		result = append(result, metric)
+	}
+	return result
+}
+
+// Handler accepts JSON metrics list or StatsD lines of text/plain body
+func Handler(sink Sink) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "text/plain") {
+			sink(Statsd(body))
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		var metrics []models.Metric
+		if err := json.Unmarshal(body, &metrics); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+
+		for _, metric := range metrics {
+			if err := metric.Check(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		sink(metrics)
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
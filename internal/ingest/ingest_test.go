@@ -0,0 +1,90 @@
+package ingest
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/models"
+	"github.com/syols/go-devops/internal/testutil"
+)
+
+func TestHandler(t *testing.T) {
+	var received []models.Metric
+	handler := Handler(func(metrics []models.Metric) {
+		received = append(received, metrics...)
+	})
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		count       int
+	}{
+		{"json", "application/json", `[{"id":"Jobs","type":"counter","delta":3},{"id":"Temp","type":"gauge","value":36.6}]`, http.StatusAccepted, 2},
+		{"statsd", "text/plain", "jobs:3|c\nqueue:+1|g\nlatency:12|ms\n", http.StatusAccepted, 1},
+		{"invalid json", "application/json", `{"id":`, http.StatusUnprocessableEntity, 0},
+		{"invalid metric", "application/json", `[{"id":"Temp","type":"gauge"}]`, http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = nil
+			request := httptest.NewRequest(http.MethodPost, "/metrics", strings.NewReader(tt.body))
+			request.Header.Set("Content-Type", tt.contentType)
+			recorder := httptest.NewRecorder()
+			handler(recorder, request)
+			assert.Equal(t, tt.status, recorder.Code)
+			assert.Len(t, received, tt.count)
+		})
+	}
+}
+
+func TestStatsdListener(t *testing.T) {
+	address := testutil.FreeUDPAddress(t)
+	received := make(chan []models.Metric, 1)
+	listener := NewListener(config.IngestConfig{StatsdAddress: &address}, func(metrics []models.Metric) {
+		received <- metrics
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go listener.Run(ctx, &wg)
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	conn, err := net.Dial("udp", address)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	deadline := time.After(5 * time.Second)
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case metrics := <-received:
+			require.Len(t, metrics, 1)
+			assert.Equal(t, "temperature", metrics[0].Name)
+			assert.Equal(t, 21.5, *metrics[0].GaugeValue)
+			return
+		case <-ticker.C:
+			_, err := conn.Write([]byte("temperature:21.5|g"))
+			require.NoError(t, err)
+		case <-deadline:
+			t.Fatal("no metrics received")
+		}
+	}
+}
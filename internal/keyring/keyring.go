@@ -0,0 +1,231 @@
+package keyring
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/syols/go-devops/config"
+)
+
+// KeyIDHeader contains ID of the public key used to encrypt request body
+const KeyIDHeader = "X-Key-ID"
+
+// Key directories of the cert layout
+const (
+	PrivateDir = "private"
+	PublicDir  = "public"
+)
+
+const keyExtension = ".pem"
+
+// Keyring active private keys identified by key ID
+type Keyring struct {
+	keys  map[string]*rsa.PrivateKey
+	file  *string
+	dir   *string
+	mutex sync.RWMutex
+}
+
+// NewKeyring creates keyring from crypto key file and keys directory
+func NewKeyring(settings config.Config) (*Keyring, error) {
+	keyring := Keyring{
+		keys: map[string]*rsa.PrivateKey{},
+		file: settings.Store.CryptoKeyFilePath,
+		dir:  settings.Store.CryptoKeysDir,
+	}
+
+	if err := keyring.Reload(); err != nil {
+		return nil, err
+	}
+	return &keyring, nil
+}
+
+// Enabled reports whether any private key is loaded
+func (k *Keyring) Enabled() bool {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	return len(k.keys) > 0
+}
+
+// Reload reads private keys from crypto key file and dir/private of keys directory written by Generate
+func (k *Keyring) Reload() error {
+	var paths []string
+	if k.file != nil {
+		paths = append(paths, *k.file)
+	}
+
+	if k.dir != nil {
+		matches, err := filepath.Glob(filepath.Join(*k.dir, PrivateDir, "*"+keyExtension))
+		if err != nil {
+			return err
+		}
+		paths = append(paths, matches...)
+	}
+
+	keys := map[string]*rsa.PrivateKey{}
+	for _, path := range paths {
+		key, err := LoadPrivateKey(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		keys[KeyID(path)] = key
+	}
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.keys = keys
+	if len(keys) > 0 {
+		log.Printf("Loaded %d private keys", len(keys))
+	}
+	return nil
+}
+
+// Watch reloads keys on SIGHUP until context is done
+func (k *Keyring) Watch(ctx context.Context) {
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
+
+	for {
+		select {
+		case <-reload:
+			if err := k.Reload(); err != nil {
+				log.Print(err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Decrypt message with key ID, every active key is tried when key ID is empty
+func (k *Keyring) Decrypt(keyID string, msg []byte) ([]byte, error) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	if len(k.keys) == 0 {
+		return msg, nil
+	}
+
+	if keyID != "" {
+		key, isOk := k.keys[keyID]
+		if isOk {
+			return rsa.DecryptOAEP(sha512.New(), rand.Reader, key, msg, nil)
+		}
+
+		// legacy crypto key file has no key ID shared with agents
+		if k.file == nil {
+			return nil, fmt.Errorf("unknown key %q", keyID)
+		}
+	}
+
+	for _, key := range k.keys {
+		if result, err := rsa.DecryptOAEP(sha512.New(), rand.Reader, key, msg, nil); err == nil {
+			return result, nil
+		}
+	}
+	return nil, errors.New("message can not be decrypted with any active key")
+}
+
+// KeyID returns key ID of the key file, file name without extension
+func KeyID(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+// PublicKeyID returns key ID of public key in keys directory layout dir/public/<id>.pem,
+// legacy key files have no key ID
+func PublicKeyID(path string) (string, bool) {
+	if filepath.Base(filepath.Dir(path)) != PublicDir || filepath.Ext(path) != keyExtension {
+		return "", false
+	}
+	return KeyID(path), true
+}
+
+// LoadPrivateKey reads PKCS1 private key from PEM file
+func LoadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	block, err := readBlock(path)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+// LoadPublicKey reads PKIX public key from PEM file
+func LoadPublicKey(path string) (*rsa.PublicKey, error) {
+	block, err := readBlock(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, isOk := key.(*rsa.PublicKey)
+	if !isOk {
+		return nil, errors.New("not a RSA public key")
+	}
+	return publicKey, nil
+}
+
+// Generate creates new key pair in dir/private and dir/public, returns key ID
+func Generate(dir string, bits int) (string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return "", err
+	}
+
+	publicBytes, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+
+	keyID := fmt.Sprintf("%s-%x", time.Now().UTC().Format("20060102T150405Z"), suffix)
+	files := map[string]*pem.Block{
+		filepath.Join(dir, PrivateDir, keyID+keyExtension): {Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)},
+		filepath.Join(dir, PublicDir, keyID+keyExtension):  {Type: "PUBLIC KEY", Bytes: publicBytes},
+	}
+
+	for path, block := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+			return "", err
+		}
+	}
+	return keyID, nil
+}
+
+func readBlock(path string) (*pem.Block, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	return block, nil
+}
@@ -0,0 +1,111 @@
+package keyring
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/syols/go-devops/config"
+)
+
+func TestKeyringRotation(t *testing.T) {
+	dir := t.TempDir()
+	oldID, err := Generate(dir, 2048)
+	require.NoError(t, err)
+
+	keys, err := NewKeyring(config.Config{Store: config.StoreConfig{CryptoKeysDir: &dir}})
+	require.NoError(t, err)
+	assert.True(t, keys.Enabled())
+
+	msg := []byte(`[{"id":"PollCount","type":"counter","delta":1}]`)
+	encrypted := encrypt(t, filepath.Join(dir, PublicDir, oldID+keyExtension), msg)
+
+	result, err := keys.Decrypt(oldID, encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, msg, result)
+
+	result, err = keys.Decrypt("", encrypted)
+	require.NoError(t, err, "legacy agent without key ID")
+	assert.Equal(t, msg, result)
+
+	_, err = keys.Decrypt("unknown", encrypted)
+	assert.Error(t, err)
+
+	newID, err := Generate(dir, 2048)
+	require.NoError(t, err)
+	rotated := encrypt(t, filepath.Join(dir, PublicDir, newID+keyExtension), msg)
+
+	_, err = keys.Decrypt(newID, rotated)
+	assert.Error(t, err, "new key is not active before reload")
+
+	require.NoError(t, keys.Reload())
+	for keyID, body := range map[string][]byte{oldID: encrypted, newID: rotated} {
+		result, err = keys.Decrypt(keyID, body)
+		require.NoError(t, err, keyID)
+		assert.Equal(t, msg, result)
+	}
+}
+
+func TestKeyringDisabled(t *testing.T) {
+	keys, err := NewKeyring(config.Config{})
+	require.NoError(t, err)
+	assert.False(t, keys.Enabled())
+
+	result, err := keys.Decrypt("", []byte("plain"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("plain"), result)
+}
+
+func TestLegacyKeyFile(t *testing.T) {
+	// legacy layout of repository cert directory, key files without extension
+	dir := t.TempDir()
+	keyID, err := Generate(dir, 2048)
+	require.NoError(t, err)
+
+	certDir := filepath.Join(dir, "cert")
+	require.NoError(t, os.Mkdir(certDir, 0700))
+	privatePath, publicPath := filepath.Join(certDir, "private"), filepath.Join(certDir, "public")
+	require.NoError(t, os.Rename(filepath.Join(dir, PrivateDir, keyID+keyExtension), privatePath))
+	require.NoError(t, os.Rename(filepath.Join(dir, PublicDir, keyID+keyExtension), publicPath))
+
+	keys, err := NewKeyring(config.Config{Store: config.StoreConfig{CryptoKeyFilePath: &privatePath}})
+	require.NoError(t, err)
+
+	agentKeyID, isOk := PublicKeyID(publicPath)
+	assert.False(t, isOk)
+	assert.Empty(t, agentKeyID)
+
+	msg := []byte(`[{"id":"PollCount","type":"counter","delta":1}]`)
+	encrypted := encrypt(t, publicPath, msg)
+	for _, sentKeyID := range []string{agentKeyID, KeyID(publicPath)} {
+		result, err := keys.Decrypt(sentKeyID, encrypted)
+		require.NoError(t, err, sentKeyID)
+		assert.Equal(t, msg, result)
+	}
+
+	_, err = LoadPrivateKey("../../cert/private")
+	require.NoError(t, err)
+	_, err = LoadPublicKey("../../cert/public")
+	require.NoError(t, err)
+	_, isOk = PublicKeyID("../../cert/public")
+	assert.False(t, isOk, "repository key is legacy key file")
+
+	keyID, isOk = PublicKeyID(filepath.Join("cert", "keys", PublicDir, "20260101T000000Z-abcd"+keyExtension))
+	assert.True(t, isOk)
+	assert.Equal(t, "20260101T000000Z-abcd", keyID)
+}
+
+func encrypt(t *testing.T, path string, msg []byte) []byte {
+	key, err := LoadPublicKey(path)
+	require.NoError(t, err)
+
+	result, err := rsa.EncryptOAEP(sha512.New(), rand.Reader, key, msg, nil)
+	require.NoError(t, err)
+	return result
+}
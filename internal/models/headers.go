@@ -0,0 +1,9 @@
+package models
+
+// Protocol headers shared by agent and server
+const (
+	// HashHeader contains HMAC-SHA256 hash sum of the whole request or response body
+	HashHeader = "HashSHA256"
+	// BatchIDHeader identifies batch update, retries of the batch carry the same ID and are applied once
+	BatchIDHeader = "X-Batch-ID"
+)
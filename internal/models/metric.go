@@ -17,11 +17,13 @@ var validate *validator.Validate
 
 // Metric struct
 type Metric struct {
-	Name         string   `json:"id" db:"id" validate:"required"`
+	Name         string   `json:"id" db:"id" validate:"required,excludes=/"`
 	MetricType   string   `json:"type" db:"metric_type" validate:"metricType,metric"`
 	CounterValue *uint64  `json:"delta,omitempty" db:"counter_value" validate:"omitempty,metricCounter"`
 	GaugeValue   *float64 `json:"value,omitempty" db:"gauge_value" validate:"omitempty,metricGauge"`
 	Hash         string   `json:"hash,omitempty" db:"hash"`
+	Derived      bool     `json:"derived,omitempty" db:"-"`
+	Tenant       string   `json:"tenant,omitempty" db:"tenant"`
 }
 
 func init() {
@@ -40,6 +42,38 @@ func init() {
 	}
 }
 
+// Gauge creates gauge metric
+func Gauge(name string, value float64) Metric {
+	return Metric{Name: name, MetricType: GaugeName, GaugeValue: &value}
+}
+
+// Counter creates counter metric with delta
+func Counter(name string, delta uint64) Metric {
+	return Metric{Name: name, MetricType: CounterName, CounterValue: &delta}
+}
+
+// Values maps metric names to values
+func Values(metrics []Metric) map[string]float64 {
+	result := map[string]float64{}
+	for _, metric := range metrics {
+		result[metric.Name] = metric.Float()
+	}
+	return result
+}
+
+// Key creates storage key of metric name in tenant namespace
+func Key(tenant, name string) string {
+	if tenant == "" {
+		return name
+	}
+	return tenant + "/" + name
+}
+
+// Key get storage key of metric
+func (p *Metric) Key() string {
+	return Key(p.Tenant, p.Name)
+}
+
 // String generates string for log metric
 func (p *Metric) String() string {
 	if p.MetricType == GaugeName {
@@ -56,6 +90,14 @@ func (p *Metric) Value() string {
 	return strconv.FormatUint(*p.CounterValue, 10)
 }
 
+// Float get metric value as float
+func (p *Metric) Float() float64 {
+	if p.MetricType == GaugeName {
+		return *p.GaugeValue
+	}
+	return float64(*p.CounterValue)
+}
+
 // Check validate metric value
 func (p *Metric) Check() error {
 	return validate.Struct(p)
@@ -87,10 +129,15 @@ func NewMetric(name, typeName, value string, key *string) Metric {
 }
 
 // CalculateHash calculate hash sum from key
-func (p *Metric) CalculateHash(key *string) (result string) {
+func (p *Metric) CalculateHash(key *string) string {
+	return Sign([]byte(p.String()), key)
+}
+
+// Sign calculate HMAC-SHA256 hash sum of data from key
+func Sign(data []byte, key *string) (result string) {
 	if key != nil {
 		h := hmac.New(sha256.New, []byte(*key))
-		h.Write([]byte(p.String()))
+		h.Write(data)
 		result = fmt.Sprintf("%x", h.Sum(nil))
 	}
 	return
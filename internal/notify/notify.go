@@ -0,0 +1,67 @@
+package notify
+
+import (
+	"context"
+	"time"
+
+	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/models"
+)
+
+// Notifier struct
+type Notifier struct {
+	webhooks []*Webhook
+}
+
+// NewNotifier creates notifier struct and starts webhook senders
+func NewNotifier(ctx context.Context, settings config.Config) (Notifier, error) {
+	var webhooks []*Webhook
+	for _, webhookSettings := range settings.Server.Webhooks {
+		webhook, err := NewWebhook(webhookSettings, settings.Server.Key)
+		if err != nil {
+			return Notifier{}, err
+		}
+
+		go webhook.Run(ctx)
+		webhooks = append(webhooks, webhook)
+	}
+
+	return Notifier{
+		webhooks: webhooks,
+	}, nil
+}
+
+// Notify pushes accepted update to matching webhooks
+func (n Notifier) Notify(previous *models.Metric, current models.Metric) {
+	if len(n.webhooks) == 0 {
+		return
+	}
+
+	event := Event{
+		Metric:   copyMetric(current),
+		Previous: previous,
+		Time:     time.Now(),
+	}
+	if previous != nil {
+		metric := copyMetric(*previous)
+		event.Previous = &metric
+	}
+
+	for _, webhook := range n.webhooks {
+		if webhook.Match(previous, current) {
+			webhook.Push(event)
+		}
+	}
+}
+
+func copyMetric(metric models.Metric) models.Metric {
+	if metric.CounterValue != nil {
+		value := *metric.CounterValue
+		metric.CounterValue = &value
+	}
+	if metric.GaugeValue != nil {
+		value := *metric.GaugeValue
+		metric.GaugeValue = &value
+	}
+	return metric
+}
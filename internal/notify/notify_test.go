@@ -0,0 +1,117 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/models"
+)
+
+func TestWebhookSigned(t *testing.T) {
+	key := "some_key"
+	received := make(chan Event, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, models.Sign(body, &key), r.Header.Get(SignatureHeader))
+
+		var event Event
+		require.NoError(t, json.Unmarshal(body, &event))
+		received <- event
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	settings := config.Config{
+		Server: config.ServerConfig{
+			Key: &key,
+			Webhooks: []config.WebhookConfig{
+				{URL: server.URL, Pattern: "^Poll", CounterDelta: 5},
+			},
+		},
+	}
+	notifier, err := NewNotifier(ctx, settings)
+	require.NoError(t, err)
+
+	previous := models.Counter("PollCount", 10)
+	notifier.Notify(nil, models.Counter("Other", 100))
+	notifier.Notify(&previous, models.Counter("PollCount", 12))
+	notifier.Notify(&previous, models.Counter("PollCount", 20))
+
+	select {
+	case event := <-received:
+		assert.Equal(t, uint64(20), *event.Metric.CounterValue)
+		assert.Equal(t, uint64(10), *event.Previous.CounterValue)
+		assert.Equal(t, event.Metric.CalculateHash(&key), event.Metric.Hash)
+	case <-time.After(time.Second):
+		assert.Fail(t, "webhook not called")
+	}
+}
+
+func TestWebhookDeadLetter(t *testing.T) {
+	calls := make(chan struct{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls <- struct{}{}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	deadLetterFile := filepath.Join(t.TempDir(), "dead_letter.json")
+	webhook, err := NewWebhook(config.WebhookConfig{
+		URL:            server.URL,
+		Retries:        2,
+		Backoff:        time.Millisecond,
+		DeadLetterFile: &deadLetterFile,
+	}, nil)
+	require.NoError(t, err)
+
+	event := Event{Metric: models.Counter("PollCount", 1), Time: time.Now()}
+	if err := webhook.send(context.Background(), event); err != nil {
+		webhook.deadLetter(event, err)
+	}
+	assert.Len(t, calls, 3)
+
+	content, err := os.ReadFile(deadLetterFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "PollCount")
+	assert.Contains(t, string(content), server.URL)
+}
+
+func TestDeadLetterConcurrent(t *testing.T) {
+	deadLetterFile := filepath.Join(t.TempDir(), "dead_letter.json")
+	webhook, err := NewWebhook(config.WebhookConfig{URL: "http://localhost", DeadLetterFile: &deadLetterFile}, nil)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			webhook.deadLetter(Event{Metric: models.Counter("PollCount", 1), Time: time.Now()}, errors.New("failed"))
+		}()
+	}
+	wg.Wait()
+
+	content, err := os.ReadFile(deadLetterFile)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	require.Len(t, lines, 20)
+	for _, line := range lines {
+		assert.True(t, json.Valid([]byte(line)), line)
+	}
+}
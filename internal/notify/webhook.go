@@ -0,0 +1,211 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/models"
+)
+
+// SignatureHeader contains HMAC-SHA256 hash sum of webhook payload
+const SignatureHeader = "X-Signature"
+
+const (
+	defaultBackoff   = time.Second
+	defaultTimeout   = 5 * time.Second
+	eventsBufferSize = 1024
+)
+
+// deadLetterMutex serializes dead letter writes of Push and Run of every webhook, webhooks can share file
+var deadLetterMutex sync.Mutex
+
+// Event webhook payload
+type Event struct {
+	Metric   models.Metric  `json:"metric"`
+	Previous *models.Metric `json:"previous,omitempty"`
+	Time     time.Time      `json:"time"`
+}
+
+// Webhook struct
+type Webhook struct {
+	url            string
+	pattern        *regexp.Regexp
+	counterDelta   uint64
+	key            *string
+	retries        int
+	backoff        time.Duration
+	deadLetterFile *string
+	client         http.Client
+	events         chan Event
+}
+
+// NewWebhook creates webhook struct
+func NewWebhook(settings config.WebhookConfig, key *string) (*Webhook, error) {
+	pattern, err := regexp.Compile(settings.Pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	if settings.Key != nil {
+		key = settings.Key
+	}
+
+	backoff := settings.Backoff
+	if backoff <= 0 {
+		backoff = defaultBackoff
+	}
+
+	timeout := settings.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	return &Webhook{
+		url:            settings.URL,
+		pattern:        pattern,
+		counterDelta:   settings.CounterDelta,
+		key:            key,
+		retries:        settings.Retries,
+		backoff:        backoff,
+		deadLetterFile: settings.DeadLetterFile,
+		client:         http.Client{Timeout: timeout},
+		events:         make(chan Event, eventsBufferSize),
+	}, nil
+}
+
+// Match checks whether the update triggers webhook
+func (w *Webhook) Match(previous *models.Metric, current models.Metric) bool {
+	if !w.pattern.MatchString(current.Name) {
+		return false
+	}
+
+	if current.MetricType != models.CounterName || w.counterDelta == 0 {
+		return true
+	}
+
+	delta := *current.CounterValue
+	if previous != nil && previous.CounterValue != nil {
+		delta -= *previous.CounterValue
+	}
+	return delta >= w.counterDelta
+}
+
+// Push event to webhook queue
+func (w *Webhook) Push(event Event) {
+	select {
+	case w.events <- event:
+	default:
+		w.deadLetter(event, fmt.Errorf("webhook %s queue is full", w.url))
+	}
+}
+
+// Run sends queued events until context is done
+func (w *Webhook) Run(ctx context.Context) {
+	for {
+		select {
+		case event := <-w.events:
+			if err := w.send(ctx, event); err != nil {
+				w.deadLetter(event, err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (w *Webhook) send(ctx context.Context, event Event) (err error) {
+	event.Metric.Hash = event.Metric.CalculateHash(w.key)
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	backoff := w.backoff
+	for attempt := 0; attempt <= w.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff):
+				backoff *= 2
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if err = w.post(ctx, body); err == nil {
+			return nil
+		}
+		log.Printf("webhook %s attempt %d: %s", w.url, attempt+1, err.Error())
+	}
+	return err
+}
+
+func (w *Webhook) post(ctx context.Context, body []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	if w.key != nil {
+		request.Header.Set(SignatureHeader, models.Sign(body, w.key))
+	}
+
+	response, err := w.client.Do(request)
+	if err != nil {
+		return err
+	}
+
+	if err := response.Body.Close(); err != nil {
+		return err
+	}
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", response.StatusCode)
+	}
+	return nil
+}
+
+func (w *Webhook) deadLetter(event Event, reason error) {
+	if w.deadLetterFile == nil {
+		log.Printf("webhook %s dropped event %s: %s", w.url, event.Metric.Name, reason.Error())
+		return
+	}
+
+	line, err := json.Marshal(struct {
+		Event
+		URL   string `json:"url"`
+		Error string `json:"error"`
+	}{event, w.url, reason.Error()})
+	if err != nil {
+		log.Print(err)
+		return
+	}
+
+	deadLetterMutex.Lock()
+	defer deadLetterMutex.Unlock()
+
+	file, err := os.OpenFile(*w.deadLetterFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+
+	defer func(file *os.File) {
+		if err := file.Close(); err != nil {
+			log.Print(err)
+		}
+	}(file)
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		log.Print(err)
+	}
+}
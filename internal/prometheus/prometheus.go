@@ -0,0 +1,180 @@
+package prometheus
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Prometheus metric family types
+const (
+	CounterType   = "counter"
+	GaugeType     = "gauge"
+	HistogramType = "histogram"
+	SummaryType   = "summary"
+	UntypedType   = "untyped"
+)
+
+// Sample parsed exposition line, type is the type of metric family
+type Sample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+	Type   string
+}
+
+// label pair of sample
+type label struct {
+	Name  string
+	Value string
+}
+
+// Parse reads text exposition format. Invalid lines are returned as errors, HELP and comments are skipped
+func Parse(reader io.Reader) ([]Sample, []error) {
+	types := map[string]string{}
+	var samples []Sample
+	var errs []error
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) >= 4 && fields[1] == "TYPE" {
+				types[fields[2]] = fields[3]
+			}
+			continue
+		}
+
+		sample, err := ParseLine(line)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%q: %w", line, err))
+			continue
+		}
+		sample.Type = familyType(types, sample.Name)
+		samples = append(samples, sample)
+	}
+
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return samples, errs
+}
+
+// ParseLine parses sample line name{label="value",...} value [timestamp], timestamp is ignored
+func ParseLine(line string) (Sample, error) {
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return Sample{}, errors.New("no metric value")
+	}
+
+	sample := Sample{Name: line[:end], Labels: map[string]string{}, Type: UntypedType}
+	rest := line[end:]
+	if strings.HasPrefix(rest, "{") {
+		labels, tail, err := parseLabels(rest[1:])
+		if err != nil {
+			return Sample{}, err
+		}
+		for _, label := range labels {
+			sample.Labels[label.Name] = label.Value
+		}
+		rest = tail
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return Sample{}, errors.New("expected value and optional timestamp")
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return Sample{}, fmt.Errorf("wrong value %q", fields[0])
+	}
+	sample.Value = value
+	return sample, nil
+}
+
+// parseLabels parses label pairs after opening brace, returns the rest of line after closing brace
+func parseLabels(line string) ([]label, string, error) {
+	var labels []label
+	for {
+		line = strings.TrimLeft(line, " \t")
+		if strings.HasPrefix(line, "}") {
+			return labels, line[1:], nil
+		}
+
+		equals := strings.Index(line, "=")
+		if equals <= 0 {
+			return nil, "", errors.New("wrong label")
+		}
+		name := strings.TrimSpace(line[:equals])
+		line = strings.TrimLeft(line[equals+1:], " \t")
+		if !strings.HasPrefix(line, `"`) {
+			return nil, "", fmt.Errorf("label %s value is not quoted", name)
+		}
+
+		value, length, err := unquote(line[1:])
+		if err != nil {
+			return nil, "", fmt.Errorf("label %s: %w", name, err)
+		}
+		labels = append(labels, label{Name: name, Value: value})
+
+		line = strings.TrimLeft(line[1+length:], " \t")
+		if strings.HasPrefix(line, ",") {
+			line = line[1:]
+		} else if !strings.HasPrefix(line, "}") {
+			return nil, "", errors.New("expected , or }")
+		}
+	}
+}
+
+// unquote reads escaped label value up to closing quote, returns value and consumed length including quote
+func unquote(line string) (string, int, error) {
+	var builder strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '"':
+			return builder.String(), i + 1, nil
+		case '\\':
+			i++
+			if i == len(line) {
+				return "", 0, errors.New("unterminated escape")
+			}
+			switch line[i] {
+			case 'n':
+				builder.WriteByte('\n')
+			case '\\', '"':
+				builder.WriteByte(line[i])
+			default:
+				return "", 0, fmt.Errorf("unknown escape \\%c", line[i])
+			}
+		default:
+			builder.WriteByte(line[i])
+		}
+	}
+	return "", 0, errors.New("unterminated label value")
+}
+
+// familyType resolves type of sample family, histogram and summary samples have suffixed names
+func familyType(types map[string]string, name string) string {
+	if kind, isOk := types[name]; isOk {
+		return kind
+	}
+
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		if family := strings.TrimSuffix(name, suffix); family != name {
+			if kind := types[family]; kind == HistogramType || kind == SummaryType {
+				return kind
+			}
+		}
+	}
+	return UntypedType
+}
@@ -0,0 +1,50 @@
+package prometheus
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const exposition = `# HELP http_requests_total Requests count.
+# TYPE http_requests_total counter
+http_requests_total{method="post",code="200"} 1027 1395066363000
+http_requests_total{method="get", path="C:\\dir\"quoted\"",} 3
+# TYPE queue_length gauge
+queue_length 12.5
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="+Inf"} 144
+latency_seconds_sum 53.4
+latency_seconds_count 144
+# TYPE rpc_seconds summary
+rpc_seconds{quantile="0.5"} 0.05
+untyped_metric NaN
+broken{method="get" 1
+`
+
+func TestParse(t *testing.T) {
+	samples, errs := Parse(strings.NewReader(exposition))
+	assert.Len(t, errs, 1)
+	require.Len(t, samples, 8)
+
+	assert.Equal(t, Sample{
+		Name:   "http_requests_total",
+		Labels: map[string]string{"method": "post", "code": "200"},
+		Value:  1027,
+		Type:   CounterType,
+	}, samples[0])
+	assert.Equal(t, `C:\dir"quoted"`, samples[1].Labels["path"])
+	assert.Equal(t, GaugeType, samples[2].Type)
+	assert.Equal(t, HistogramType, samples[3].Type)
+	assert.Equal(t, "+Inf", samples[3].Labels["le"])
+	assert.Equal(t, HistogramType, samples[5].Type)
+	assert.Equal(t, SummaryType, samples[6].Type)
+	assert.Equal(t, UntypedType, samples[7].Type)
+
+	for _, line := range []string{"name", "name{a=b} 1", `name{a="b} 1`, "name abc", "name 1 2 3"} {
+		_, err := ParseLine(line)
+		assert.Error(t, err, line)
+	}
+}
@@ -0,0 +1,371 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/syols/go-devops/internal/history"
+	"github.com/syols/go-devops/internal/models"
+	"github.com/syols/go-devops/internal/store"
+)
+
+// Engine evaluates queries against metrics storage and history
+type Engine struct {
+	metrics store.MetricsStorage
+	history history.History
+}
+
+// lookback window of history searched for instant value at past time
+const lookback = 5 * time.Minute
+
+type evaluation struct {
+	ctx        context.Context
+	tenant     string
+	at         time.Time
+	latest     bool
+	resolution history.Resolution
+}
+
+// NewEngine creates query engine, history is optional
+func NewEngine(metrics store.MetricsStorage, samples history.History) Engine {
+	return Engine{
+		metrics: metrics,
+		history: samples,
+	}
+}
+
+// Query parses and evaluates query at time in tenant namespace. Zero time evaluates latest stored values,
+// instant values at explicit time are read from history
+func (e Engine) Query(ctx context.Context, tenant, source string, at time.Time, resolution history.Resolution) (Result, error) {
+	node, err := Parse(source)
+	if err != nil {
+		return Result{}, err
+	}
+
+	ev := evaluation{ctx: ctx, tenant: tenant, at: at, latest: at.IsZero(), resolution: resolution}
+	if ev.latest {
+		ev.at = time.Now()
+	}
+	value, err := e.eval(ev, node)
+	if err != nil {
+		return Result{}, err
+	}
+	return newResult(value), nil
+}
+
+func (e Engine) eval(ev evaluation, node Node) (interface{}, error) {
+	switch n := node.(type) {
+	case numberNode:
+		return Scalar{Time: ev.at, Value: n.value}, nil
+	case selectorNode:
+		if n.window > 0 {
+			return e.evalRange(ev, n)
+		}
+		return e.evalInstant(ev, n)
+	case functionNode:
+		return e.evalFunction(ev, n)
+	case aggregationNode:
+		return e.evalAggregation(ev, n)
+	case binaryNode:
+		return e.evalBinary(ev, n)
+	}
+	return nil, fmt.Errorf("unknown node %T", node)
+}
+
+// evalInstant returns values of matching series at evaluation time
+func (e Engine) evalInstant(ev evaluation, node selectorNode) (Vector, error) {
+	current := e.selectSeries(ev, node)
+	if ev.latest {
+		return current, nil
+	}
+
+	if e.history == nil {
+		return nil, errors.New("queries at explicit time require history")
+	}
+
+	var result Vector
+	for _, sample := range current {
+		key := models.Key(ev.tenant, sample.Metric[NameLabel])
+		points, err := e.history.Points(ev.ctx, key, ev.resolution, ev.at.Add(-lookback), ev.at)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(points) == 0 {
+			continue
+		}
+		last := points[0]
+		for _, point := range points {
+			if point.Time.After(last.Time) {
+				last = point
+			}
+		}
+		sample.Value.Value = last.Last
+		result = append(result, sample)
+	}
+	return result, nil
+}
+
+// selectSeries returns stored values of tenant series matching selector
+func (e Engine) selectSeries(ev evaluation, node selectorNode) Vector {
+	var result Vector
+	for _, metric := range e.metrics.List() {
+		if metric.Tenant != ev.tenant || (metric.GaugeValue == nil && metric.CounterValue == nil) {
+			continue
+		}
+
+		labels := Labels{NameLabel: metric.Name, TypeLabel: metric.MetricType}
+		if matchAll(node.matchers, labels) {
+			result = append(result, Sample{Metric: labels, Value: Point{Time: ev.at, Value: metric.Float()}})
+		}
+	}
+	sortVector(result)
+	return result
+}
+
+func (e Engine) evalRange(ev evaluation, node selectorNode) (Matrix, error) {
+	if e.history == nil {
+		return nil, errors.New("range selectors require history")
+	}
+
+	var result Matrix
+	for _, sample := range e.selectSeries(ev, node) {
+		key := models.Key(ev.tenant, sample.Metric[NameLabel])
+		points, err := e.history.Points(ev.ctx, key, ev.resolution, ev.at.Add(-node.window), ev.at)
+		if err != nil {
+			return nil, err
+		}
+
+		series := Series{Metric: sample.Metric}
+		for _, point := range points {
+			series.Values = append(series.Values, Point{Time: point.Time, Value: point.Last})
+		}
+		if len(series.Values) > 0 {
+			result = append(result, series)
+		}
+	}
+	return result, nil
+}
+
+func (e Engine) evalFunction(ev evaluation, node functionNode) (interface{}, error) {
+	selector, isOk := node.argument.(selectorNode)
+	if !isOk || selector.window == 0 {
+		return nil, fmt.Errorf("%s expects range selector", node.name)
+	}
+
+	if e.history == nil {
+		return nil, errors.New("range selectors require history")
+	}
+
+	var result Vector
+	for _, sample := range e.selectSeries(ev, selector) {
+		key := models.Key(ev.tenant, sample.Metric[NameLabel])
+		points, err := e.history.Points(ev.ctx, key, ev.resolution, ev.at.Add(-selector.window), ev.at)
+		if err != nil {
+			return nil, err
+		}
+
+		if value, isOk := overTime(node.name, points); isOk {
+			result = append(result, Sample{Metric: sample.Metric.withoutName(), Value: Point{Time: ev.at, Value: value}})
+		}
+	}
+	return result, nil
+}
+
+func overTime(name string, points []history.Point) (float64, bool) {
+	if len(points) == 0 {
+		return 0, false
+	}
+
+	first, last := points[0], points[len(points)-1]
+	var result float64
+	switch name {
+	case "rate", "increase":
+		if len(points) < 2 {
+			return 0, false
+		}
+		result = last.Last - first.Last
+		if name == "rate" {
+			seconds := last.Time.Sub(first.Time).Seconds()
+			if seconds <= 0 {
+				return 0, false
+			}
+			result /= seconds
+		}
+	case "last_over_time":
+		result = last.Last
+	case "min_over_time":
+		result = math.Inf(1)
+		for _, point := range points {
+			result = math.Min(result, point.Min)
+		}
+	case "max_over_time":
+		result = math.Inf(-1)
+		for _, point := range points {
+			result = math.Max(result, point.Max)
+		}
+	case "sum_over_time", "avg_over_time", "count_over_time":
+		var sum float64
+		var count uint64
+		for _, point := range points {
+			sum += point.Sum
+			count += point.Count
+		}
+		result = sum
+		if name == "avg_over_time" {
+			result = sum / float64(count)
+		}
+		if name == "count_over_time" {
+			result = float64(count)
+		}
+	default:
+		return 0, false
+	}
+	return result, true
+}
+
+func (e Engine) evalAggregation(ev evaluation, node aggregationNode) (interface{}, error) {
+	value, err := e.eval(ev, node.argument)
+	if err != nil {
+		return nil, err
+	}
+
+	vector, isOk := value.(Vector)
+	if !isOk {
+		return nil, fmt.Errorf("%s expects instant vector", node.operator)
+	}
+
+	groups := map[string]*Sample{}
+	counts := map[string]float64{}
+	var order []string
+	for _, sample := range vector {
+		key := sample.Metric.signature(node.labels, node.without)
+		group, isOk := groups[key]
+		if !isOk {
+			group = &Sample{Metric: sample.Metric.group(node.labels, node.without), Value: sample.Value}
+			groups[key] = group
+			order = append(order, key)
+			counts[key] = 1
+			continue
+		}
+
+		counts[key]++
+		switch node.operator {
+		case "sum", "avg":
+			group.Value.Value += sample.Value.Value
+		case "min":
+			group.Value.Value = math.Min(group.Value.Value, sample.Value.Value)
+		case "max":
+			group.Value.Value = math.Max(group.Value.Value, sample.Value.Value)
+		}
+	}
+
+	var result Vector
+	for _, key := range order {
+		group := groups[key]
+		switch node.operator {
+		case "avg":
+			group.Value.Value /= counts[key]
+		case "count":
+			group.Value.Value = counts[key]
+		}
+		result = append(result, *group)
+	}
+	sortVector(result)
+	return result, nil
+}
+
+func (e Engine) evalBinary(ev evaluation, node binaryNode) (interface{}, error) {
+	left, err := e.eval(ev, node.left)
+	if err != nil {
+		return nil, err
+	}
+
+	right, err := e.eval(ev, node.right)
+	if err != nil {
+		return nil, err
+	}
+
+	switch l := left.(type) {
+	case Scalar:
+		switch r := right.(type) {
+		case Scalar:
+			return Scalar{Time: ev.at, Value: arithmetic(node.operator, l.Value, r.Value)}, nil
+		case Vector:
+			return mapVector(r, func(value float64) float64 {
+				return arithmetic(node.operator, l.Value, value)
+			}), nil
+		}
+	case Vector:
+		switch r := right.(type) {
+		case Scalar:
+			return mapVector(l, func(value float64) float64 {
+				return arithmetic(node.operator, value, r.Value)
+			}), nil
+		case Vector:
+			return matchVectors(node.operator, l, r), nil
+		}
+	}
+	return nil, fmt.Errorf("operator %s is not defined for range matrix", node.operator)
+}
+
+func matchVectors(operator string, left, right Vector) Vector {
+	index := map[string]Sample{}
+	for _, sample := range right {
+		index[sample.Metric.withoutName().String()] = sample
+	}
+
+	var result Vector
+	for _, sample := range left {
+		labels := sample.Metric.withoutName()
+		if other, isOk := index[labels.String()]; isOk {
+			value := arithmetic(operator, sample.Value.Value, other.Value.Value)
+			result = append(result, Sample{Metric: labels, Value: Point{Time: sample.Value.Time, Value: value}})
+		}
+	}
+	return result
+}
+
+func mapVector(vector Vector, fn func(float64) float64) Vector {
+	var result Vector
+	for _, sample := range vector {
+		result = append(result, Sample{
+			Metric: sample.Metric.withoutName(),
+			Value:  Point{Time: sample.Value.Time, Value: fn(sample.Value.Value)},
+		})
+	}
+	return result
+}
+
+func arithmetic(operator string, left, right float64) float64 {
+	switch operator {
+	case "+":
+		return left + right
+	case "-":
+		return left - right
+	case "*":
+		return left * right
+	case "/":
+		return left / right
+	}
+	return math.NaN()
+}
+
+func matchAll(matchers []matcher, labels Labels) bool {
+	for _, m := range matchers {
+		if !m.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func sortVector(vector Vector) {
+	sort.Slice(vector, func(i, j int) bool {
+		return vector[i].Metric.String() < vector[j].Metric.String()
+	})
+}
@@ -0,0 +1,99 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	eofToken tokenKind = iota
+	identifierToken
+	numberToken
+	stringToken
+	durationToken
+	operatorToken
+)
+
+type token struct {
+	kind     tokenKind
+	value    string
+	position int
+}
+
+func (t token) String() string {
+	if t.kind == eofToken {
+		return "end of query"
+	}
+	return fmt.Sprintf("%q at %d", t.value, t.position)
+}
+
+var operators = []string{"!=", "=~", "!~", "=", "+", "-", "*", "/", "(", ")", "{", "}", ","}
+
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	symbols := []rune(source)
+	for position := 0; position < len(symbols); {
+		symbol := symbols[position]
+		switch {
+		case unicode.IsSpace(symbol):
+			position++
+		case unicode.IsLetter(symbol) || symbol == '_':
+			start := position
+			for position < len(symbols) && isIdentifierSymbol(symbols[position]) {
+				position++
+			}
+			tokens = append(tokens, token{kind: identifierToken, value: string(symbols[start:position]), position: start})
+		case unicode.IsDigit(symbol) || symbol == '.':
+			start := position
+			for position < len(symbols) && (unicode.IsDigit(symbols[position]) || symbols[position] == '.') {
+				position++
+			}
+			tokens = append(tokens, token{kind: numberToken, value: string(symbols[start:position]), position: start})
+		case symbol == '"' || symbol == '\'':
+			start := position
+			position++
+			for position < len(symbols) && symbols[position] != symbol {
+				position++
+			}
+			if position >= len(symbols) {
+				return nil, fmt.Errorf("unterminated string at %d", start)
+			}
+			tokens = append(tokens, token{kind: stringToken, value: string(symbols[start+1 : position]), position: start})
+			position++
+		case symbol == '[':
+			start := position
+			for position < len(symbols) && symbols[position] != ']' {
+				position++
+			}
+			if position >= len(symbols) {
+				return nil, fmt.Errorf("unterminated range at %d", start)
+			}
+			tokens = append(tokens, token{kind: durationToken, value: strings.TrimSpace(string(symbols[start+1 : position])), position: start})
+			position++
+		default:
+			operator := matchOperator(string(symbols[position:]))
+			if operator == "" {
+				return nil, fmt.Errorf("unexpected symbol %q at %d", symbol, position)
+			}
+			tokens = append(tokens, token{kind: operatorToken, value: operator, position: position})
+			position += len(operator)
+		}
+	}
+	return append(tokens, token{kind: eofToken, position: len(symbols)}), nil
+}
+
+func matchOperator(source string) string {
+	for _, operator := range operators {
+		if strings.HasPrefix(source, operator) {
+			return operator
+		}
+	}
+	return ""
+}
+
+func isIdentifierSymbol(symbol rune) bool {
+	return unicode.IsLetter(symbol) || unicode.IsDigit(symbol) || symbol == '_' || symbol == ':'
+}
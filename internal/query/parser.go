@@ -0,0 +1,338 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Node of parsed query
+type Node interface{}
+
+type numberNode struct {
+	value float64
+}
+
+type matcher struct {
+	label    string
+	operator string
+	value    string
+	regexp   *regexp.Regexp
+}
+
+type selectorNode struct {
+	matchers []matcher
+	window   time.Duration
+}
+
+type functionNode struct {
+	name     string
+	argument Node
+}
+
+type aggregationNode struct {
+	operator string
+	without  bool
+	labels   []string
+	argument Node
+}
+
+type binaryNode struct {
+	operator    string
+	left, right Node
+}
+
+var rangeFunctions = map[string]struct{}{
+	"rate":            {},
+	"increase":        {},
+	"avg_over_time":   {},
+	"min_over_time":   {},
+	"max_over_time":   {},
+	"sum_over_time":   {},
+	"count_over_time": {},
+	"last_over_time":  {},
+}
+
+var aggregations = map[string]struct{}{
+	"sum":   {},
+	"avg":   {},
+	"min":   {},
+	"max":   {},
+	"count": {},
+}
+
+// Parse parses query like `sum by (type) (rate(PollCount[1m]))`
+func Parse(source string) (Node, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser{tokens: tokens}
+	node, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek().kind != eofToken {
+		return nil, fmt.Errorf("unexpected %s", p.peek())
+	}
+	return node, nil
+}
+
+type parser struct {
+	tokens   []token
+	position int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.position]
+}
+
+func (p *parser) next() token {
+	current := p.tokens[p.position]
+	if current.kind != eofToken {
+		p.position++
+	}
+	return current
+}
+
+func (p *parser) isOperator(values ...string) bool {
+	current := p.peek()
+	if current.kind != operatorToken {
+		return false
+	}
+	for _, value := range values {
+		if current.value == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) expect(value string) error {
+	if !p.isOperator(value) {
+		return fmt.Errorf("expected %q, got %s", value, p.peek())
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) parseSum() (Node, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOperator("+", "-") {
+		operator := p.next().value
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{operator: operator, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseProduct() (Node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOperator("*", "/") {
+		operator := p.next().value
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{operator: operator, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	if p.isOperator("-") {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return binaryNode{operator: "*", left: numberNode{value: -1}, right: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	current := p.peek()
+	switch {
+	case current.kind == numberToken:
+		p.next()
+		value, err := strconv.ParseFloat(current.value, 64)
+		if err != nil {
+			return nil, err
+		}
+		return numberNode{value: value}, nil
+	case p.isOperator("("):
+		p.next()
+		node, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		return node, p.expect(")")
+	case p.isOperator("{"):
+		return p.parseSelector("")
+	case current.kind == identifierToken:
+		p.next()
+		if _, isOk := aggregations[current.value]; isOk {
+			return p.parseAggregation(current.value)
+		}
+		if _, isOk := rangeFunctions[current.value]; isOk && p.isOperator("(") {
+			return p.parseFunction(current.value)
+		}
+		return p.parseSelector(current.value)
+	}
+	return nil, fmt.Errorf("unexpected %s", current)
+}
+
+func (p *parser) parseFunction(name string) (Node, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	argument, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	return functionNode{name: name, argument: argument}, p.expect(")")
+}
+
+func (p *parser) parseAggregation(operator string) (Node, error) {
+	node := aggregationNode{operator: operator}
+	if err := p.parseGrouping(&node); err != nil {
+		return nil, err
+	}
+
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	argument, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	node.argument = argument
+
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return node, p.parseGrouping(&node)
+}
+
+func (p *parser) parseGrouping(node *aggregationNode) error {
+	current := p.peek()
+	if current.kind != identifierToken || (current.value != "by" && current.value != "without") {
+		return nil
+	}
+
+	p.next()
+	node.without = current.value == "without"
+	if err := p.expect("("); err != nil {
+		return err
+	}
+
+	for !p.isOperator(")") {
+		label := p.next()
+		if label.kind != identifierToken {
+			return fmt.Errorf("expected label name, got %s", label)
+		}
+		node.labels = append(node.labels, label.value)
+		if !p.isOperator(")") {
+			if err := p.expect(","); err != nil {
+				return err
+			}
+		}
+	}
+	return p.expect(")")
+}
+
+func (p *parser) parseSelector(name string) (Node, error) {
+	var node selectorNode
+	if name != "" {
+		node.matchers = append(node.matchers, matcher{label: NameLabel, operator: "=", value: name})
+	}
+
+	if p.isOperator("{") {
+		p.next()
+		for !p.isOperator("}") {
+			current, err := p.parseMatcher()
+			if err != nil {
+				return nil, err
+			}
+			node.matchers = append(node.matchers, current)
+			if !p.isOperator("}") {
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+		}
+		p.next()
+	}
+
+	if len(node.matchers) == 0 {
+		return nil, fmt.Errorf("empty selector at %d", p.peek().position)
+	}
+
+	if p.peek().kind == durationToken {
+		window, err := time.ParseDuration(p.next().value)
+		if err != nil {
+			return nil, err
+		}
+		node.window = window
+	}
+	return node, nil
+}
+
+func (p *parser) parseMatcher() (matcher, error) {
+	label := p.next()
+	if label.kind != identifierToken {
+		return matcher{}, fmt.Errorf("expected label name, got %s", label)
+	}
+
+	if !p.isOperator("=", "!=", "=~", "!~") {
+		return matcher{}, fmt.Errorf("expected label matcher, got %s", p.peek())
+	}
+	operator := p.next().value
+
+	value := p.next()
+	if value.kind != stringToken {
+		return matcher{}, fmt.Errorf("expected label value, got %s", value)
+	}
+
+	result := matcher{label: label.value, operator: operator, value: value.value}
+	if operator == "=~" || operator == "!~" {
+		compiled, err := regexp.Compile("^(?:" + value.value + ")$")
+		if err != nil {
+			return matcher{}, err
+		}
+		result.regexp = compiled
+	}
+	return result, nil
+}
+
+func (m matcher) matches(labels Labels) bool {
+	value := labels[m.label]
+	switch m.operator {
+	case "=":
+		return value == m.value
+	case "!=":
+		return value != m.value
+	case "=~":
+		return m.regexp.MatchString(value)
+	case "!~":
+		return !m.regexp.MatchString(value)
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/history"
+	"github.com/syols/go-devops/internal/models"
+	"github.com/syols/go-devops/internal/store"
+)
+
+func newEngine(t *testing.T, now time.Time) Engine {
+	metrics := store.NewMetrics(nil, nil)
+	samples := history.NewMemoryHistory(history.NewRetention(config.HistoryConfig{}))
+	for name, value := range map[string]float64{"HeapInuse": 30, "HeapSys": 60, "Alloc": 10} {
+		v := value
+		metrics.Metrics[name] = models.Metric{Name: name, MetricType: models.GaugeName, GaugeValue: &v}
+	}
+
+	pollCount := uint64(40)
+	metrics.Metrics["PollCount"] = models.Metric{Name: "PollCount", MetricType: models.CounterName, CounterValue: &pollCount}
+	for i := 0; i < 5; i++ {
+		at := now.Add(-time.Duration(4-i) * 10 * time.Second)
+		point := history.NewPoint("PollCount", models.CounterName, 10, float64(i*10), at)
+		require.NoError(t, samples.Add(context.Background(), point))
+	}
+	return NewEngine(metrics, samples)
+}
+
+func TestParse(t *testing.T) {
+	for _, source := range []string{
+		"Alloc",
+		`{__name__=~"Heap.*", type!="counter"}`,
+		"rate(PollCount[1m])",
+		"sum by (type) (Alloc)",
+		"sum(Alloc) without (type)",
+		"-(HeapInuse / HeapSys) * 100",
+	} {
+		_, err := Parse(source)
+		assert.NoError(t, err, source)
+	}
+
+	for _, source := range []string{"", "{}", "Alloc{type}", "rate(PollCount[1m]", "sum by type (Alloc)", "Alloc $"} {
+		_, err := Parse(source)
+		assert.Error(t, err, source)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	engine := newEngine(t, now)
+
+	result, err := engine.Query(ctx, "", "HeapInuse / HeapSys * 100", time.Time{}, history.Raw)
+	require.NoError(t, err)
+	assert.Equal(t, VectorType, result.ResultType)
+	vector := result.Result.(Vector)
+	require.Len(t, vector, 1)
+	assert.Equal(t, 50.0, vector[0].Value.Value)
+	assert.Equal(t, Labels{TypeLabel: models.GaugeName}, vector[0].Metric)
+
+	result, err = engine.Query(ctx, "", `count({__name__=~"Heap.*"})`, time.Time{}, history.Raw)
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, result.Result.(Vector)[0].Value.Value)
+
+	result, err = engine.Query(ctx, "", "sum by (type) ({type=~\".+\"})", time.Time{}, history.Raw)
+	require.NoError(t, err)
+	assert.Len(t, result.Result.(Vector), 2)
+
+	result, err = engine.Query(ctx, "", "rate(PollCount[1m])", now, history.Raw)
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, result.Result.(Vector)[0].Value.Value)
+
+	result, err = engine.Query(ctx, "", "sum_over_time(PollCount[25s])", now, history.Raw)
+	require.NoError(t, err)
+	assert.Equal(t, 30.0, result.Result.(Vector)[0].Value.Value)
+
+	result, err = engine.Query(ctx, "", "PollCount[1m]", now, history.Raw)
+	require.NoError(t, err)
+	assert.Equal(t, MatrixType, result.ResultType)
+	assert.Len(t, result.Result.(Matrix)[0].Values, 5)
+
+	result, err = engine.Query(ctx, "", "2 * 3", time.Time{}, history.Raw)
+	require.NoError(t, err)
+	assert.Equal(t, ScalarType, result.ResultType)
+	_, err = json.Marshal(result)
+	assert.NoError(t, err)
+
+	_, err = engine.Query(ctx, "", "PollCount[1m] + 1", now, history.Raw)
+	assert.Error(t, err)
+
+	result, err = engine.Query(ctx, "", "PollCount", time.Time{}, history.Raw)
+	require.NoError(t, err)
+	assert.Equal(t, 40.0, result.Result.(Vector)[0].Value.Value, "latest stored value")
+
+	result, err = engine.Query(ctx, "", "PollCount", now.Add(-25*time.Second), history.Raw)
+	require.NoError(t, err)
+	assert.Equal(t, 10.0, result.Result.(Vector)[0].Value.Value, "value at past time is read from history")
+
+	_, err = NewEngine(store.NewMetrics(nil, nil), nil).Query(ctx, "", "rate(PollCount[1m])", now, history.Raw)
+	assert.Error(t, err)
+}
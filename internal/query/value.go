@@ -0,0 +1,134 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NameLabel label containing metric name
+const NameLabel = "__name__"
+
+// TypeLabel label containing metric type
+const TypeLabel = "type"
+
+// Query result types
+const (
+	ScalarType = "scalar"
+	VectorType = "vector"
+	MatrixType = "matrix"
+)
+
+// Labels of series
+type Labels map[string]string
+
+// Point value at time
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// Sample of instant vector
+type Sample struct {
+	Metric Labels `json:"metric"`
+	Value  Point  `json:"value"`
+}
+
+// Series of range matrix
+type Series struct {
+	Metric Labels  `json:"metric"`
+	Values []Point `json:"values"`
+}
+
+// Scalar value
+type Scalar Point
+
+// Vector instant vector
+type Vector []Sample
+
+// Matrix range matrix
+type Matrix []Series
+
+// Result of query
+type Result struct {
+	ResultType string      `json:"resultType"`
+	Result     interface{} `json:"result"`
+}
+
+// MarshalJSON encodes point as [unix time, "value"], value is a string to keep NaN and Inf
+func (p Point) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{
+		float64(p.Time.UnixNano()) / float64(time.Second),
+		strconv.FormatFloat(p.Value, 'f', -1, 64),
+	})
+}
+
+// MarshalJSON encodes scalar like point
+func (s Scalar) MarshalJSON() ([]byte, error) {
+	return Point(s).MarshalJSON()
+}
+
+// String formats labels sorted by name
+func (l Labels) String() string {
+	var keys []string
+	for key := range l {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", key, l[key]))
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+func (l Labels) signature(labels []string, without bool) string {
+	return l.group(labels, without).String()
+}
+
+func (l Labels) group(labels []string, without bool) Labels {
+	result := Labels{}
+	if without {
+		for key, value := range l {
+			result[key] = value
+		}
+		for _, label := range labels {
+			delete(result, label)
+		}
+		delete(result, NameLabel)
+		return result
+	}
+
+	for _, label := range labels {
+		if value, isOk := l[label]; isOk {
+			result[label] = value
+		}
+	}
+	return result
+}
+
+func (l Labels) withoutName() Labels {
+	return l.group(nil, true)
+}
+
+func newResult(value interface{}) Result {
+	switch result := value.(type) {
+	case Scalar:
+		return Result{ResultType: ScalarType, Result: result}
+	case Matrix:
+		if result == nil {
+			result = Matrix{}
+		}
+		return Result{ResultType: MatrixType, Result: result}
+	case Vector:
+		if result == nil {
+			result = Vector{}
+		}
+		return Result{ResultType: VectorType, Result: result}
+	}
+	return Result{}
+}
@@ -0,0 +1,35 @@
+package queue
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultMinBackoff = time.Second
+	defaultMaxBackoff = time.Minute
+)
+
+// Backoff returns exponential delay with jitter before retry attempt, in range [delay/2, delay]
+func Backoff(attempt int, min, max time.Duration) time.Duration {
+	if min <= 0 {
+		min = defaultMinBackoff
+	}
+	if max <= 0 {
+		max = defaultMaxBackoff
+	}
+	if max < min {
+		max = min
+	}
+
+	delay := min
+	for i := 0; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
@@ -0,0 +1,166 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/models"
+)
+
+const defaultSize = 10000
+
+// Queue bounded outgoing metrics queue. Gauges are coalesced (latest wins), counter deltas are summed
+type Queue struct {
+	gauges   map[string]float64
+	counters map[string]uint64
+	size     int
+	file     *string
+	mutex    sync.Mutex
+}
+
+// NewQueue creates queue struct
+func NewQueue(settings config.QueueConfig) *Queue {
+	size := settings.Size
+	if size <= 0 {
+		size = defaultSize
+	}
+
+	return &Queue{
+		gauges:   map[string]float64{},
+		counters: map[string]uint64{},
+		size:     size,
+		file:     settings.File,
+	}
+}
+
+// Push metrics to queue, metrics with new names are dropped when queue is full.
+// Returns number of dropped metrics
+func (q *Queue) Push(metrics ...models.Metric) int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	dropped := 0
+	for _, metric := range metrics {
+		if !q.push(metric, true) {
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// Requeue returns batch failed to send to queue, newer gauge values are kept.
+// Returns number of dropped metrics
+func (q *Queue) Requeue(metrics []models.Metric) int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	dropped := 0
+	for _, metric := range metrics {
+		if !q.push(metric, false) {
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// Take all queued metrics and clear queue
+func (q *Queue) Take() []models.Metric {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	result := q.metrics()
+	q.gauges = map[string]float64{}
+	q.counters = map[string]uint64{}
+	return result
+}
+
+// Len returns count of queued metrics
+func (q *Queue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.gauges) + len(q.counters)
+}
+
+// Spill queued metrics and metrics of pending batches to file, file is removed when nothing is queued
+func (q *Queue) Spill(pending ...models.Metric) error {
+	if q.file == nil {
+		return nil
+	}
+
+	q.mutex.Lock()
+	metrics := append(q.metrics(), pending...)
+	q.mutex.Unlock()
+
+	if len(metrics) == 0 {
+		if err := os.Remove(*q.file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	content, err := json.Marshal(metrics)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(*q.file, content, 0644)
+}
+
+// Restore queued metrics spilled to file by previous run
+func (q *Queue) Restore() error {
+	if q.file == nil {
+		return nil
+	}
+
+	content, err := os.ReadFile(*q.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var metrics []models.Metric
+	if err := json.Unmarshal(content, &metrics); err != nil {
+		return err
+	}
+
+	q.Requeue(metrics)
+	log.Printf("Restored %d queued metrics from %s", len(metrics), *q.file)
+	return nil
+}
+
+func (q *Queue) push(metric models.Metric, latest bool) bool {
+	_, isGauge := q.gauges[metric.Name]
+	_, isCounter := q.counters[metric.Name]
+	if !isGauge && !isCounter && len(q.gauges)+len(q.counters) >= q.size {
+		log.Printf("queue is full, metric %s dropped", metric.Name)
+		return false
+	}
+
+	switch metric.MetricType {
+	case models.GaugeName:
+		if metric.GaugeValue != nil && (latest || !isGauge) {
+			q.gauges[metric.Name] = *metric.GaugeValue
+		}
+	case models.CounterName:
+		if metric.CounterValue != nil {
+			q.counters[metric.Name] += *metric.CounterValue
+		}
+	}
+	return true
+}
+
+func (q *Queue) metrics() []models.Metric {
+	result := make([]models.Metric, 0, len(q.gauges)+len(q.counters))
+	for name, value := range q.gauges {
+		result = append(result, models.Gauge(name, value))
+	}
+	for name, value := range q.counters {
+		result = append(result, models.Counter(name, value))
+	}
+	return result
+}
@@ -0,0 +1,53 @@
+package queue
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/models"
+)
+
+func TestQueueCoalesce(t *testing.T) {
+	queue := NewQueue(config.QueueConfig{Size: 2})
+	queue.Push(models.Gauge("Alloc", 1), models.Counter("PollCount", 1))
+	assert.Equal(t, 1, queue.Push(models.Gauge("Alloc", 2), models.Counter("PollCount", 2), models.Gauge("Dropped", 1)))
+	assert.Equal(t, 2, queue.Len())
+
+	batch := queue.Take()
+	assert.Equal(t, map[string]float64{"Alloc": 2, "PollCount": 3}, models.Values(batch))
+	assert.Equal(t, 0, queue.Len())
+
+	queue.Push(models.Gauge("Alloc", 5), models.Counter("PollCount", 1))
+	queue.Requeue(batch)
+	assert.Equal(t, map[string]float64{"Alloc": 5, "PollCount": 4}, models.Values(queue.Take()))
+}
+
+func TestQueueSpill(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "queue.json")
+	queue := NewQueue(config.QueueConfig{File: &file})
+	queue.Push(models.Gauge("Alloc", 1), models.Counter("PollCount", 3))
+	require.NoError(t, queue.Spill(models.Counter("PollCount", 2)))
+
+	restored := NewQueue(config.QueueConfig{File: &file})
+	require.NoError(t, restored.Restore())
+	assert.Equal(t, map[string]float64{"Alloc": 1, "PollCount": 5}, models.Values(restored.Take()), "pending batches are spilled too")
+
+	require.NoError(t, restored.Spill())
+	assert.NoFileExists(t, file)
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		delay := Backoff(attempt, time.Second, 3*time.Second)
+		if expected > 3*time.Second {
+			expected = 3 * time.Second
+		}
+		assert.GreaterOrEqual(t, delay, expected/2)
+		assert.LessOrEqual(t, delay, expected)
+	}
+}
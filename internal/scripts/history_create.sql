@@ -0,0 +1,12 @@
+CREATE TABLE metric_history (
+     id VARCHAR(256) NOT NULL,
+     metric_type VARCHAR(256) NOT NULL,
+     resolution VARCHAR(16) NOT NULL,
+     time TIMESTAMP WITH TIME ZONE NOT NULL,
+     min_value DOUBLE PRECISION NOT NULL,
+     max_value DOUBLE PRECISION NOT NULL,
+     last_value DOUBLE PRECISION NOT NULL,
+     sum_value DOUBLE PRECISION NOT NULL,
+     count BIGINT NOT NULL,
+     CONSTRAINT metric_history_pk PRIMARY KEY (id, resolution, time)
+);
\ No newline at end of file
@@ -0,0 +1 @@
+DELETE FROM metric_history WHERE resolution = $1 AND time < $2;
\ No newline at end of file
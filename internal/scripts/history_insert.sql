@@ -0,0 +1,16 @@
+INSERT INTO metric_history
+    (
+        id, metric_type, resolution, time, min_value, max_value, last_value, sum_value, count
+    )
+VALUES
+    (
+        :id, :metric_type, :resolution, :time, :min_value, :max_value, :last_value, :sum_value, :count
+    )
+ON CONFLICT (id, resolution, time) DO
+    UPDATE
+    SET
+        min_value = LEAST(metric_history.min_value, excluded.min_value),
+        max_value = GREATEST(metric_history.max_value, excluded.max_value),
+        last_value = excluded.last_value,
+        sum_value = metric_history.sum_value + excluded.sum_value,
+        count = metric_history.count + excluded.count;
\ No newline at end of file
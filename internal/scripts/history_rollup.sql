@@ -0,0 +1,18 @@
+INSERT INTO metric_history
+    (
+        id, metric_type, resolution, time, min_value, max_value, last_value, sum_value, count
+    )
+SELECT
+    id, metric_type, $2, date_trunc($3, time) AS bucket,
+    MIN(min_value), MAX(max_value), (ARRAY_AGG(last_value ORDER BY time DESC))[1], SUM(sum_value), SUM(count)
+FROM metric_history
+WHERE resolution = $1 AND time < $4
+GROUP BY id, metric_type, bucket
+ON CONFLICT (id, resolution, time) DO
+    UPDATE
+    SET
+        min_value = LEAST(metric_history.min_value, excluded.min_value),
+        max_value = GREATEST(metric_history.max_value, excluded.max_value),
+        last_value = excluded.last_value,
+        sum_value = metric_history.sum_value + excluded.sum_value,
+        count = metric_history.count + excluded.count;
\ No newline at end of file
@@ -0,0 +1,4 @@
+SELECT id, metric_type, resolution, time, min_value, max_value, last_value, sum_value, count
+FROM metric_history
+WHERE id = $1 AND resolution = ANY($2) AND time >= $3 AND time <= $4
+ORDER BY time;
\ No newline at end of file
@@ -1,12 +1,12 @@
 INSERT INTO metrics
     (
-        id, metric_type, counter_value, gauge_value, hash
+        tenant, id, metric_type, counter_value, gauge_value, hash
     )
 VALUES
     (
-        :id, :metric_type, :counter_value, :gauge_value, :hash
+        :tenant, :id, :metric_type, :counter_value, :gauge_value, :hash
     )
-ON CONFLICT (id) DO
+ON CONFLICT (tenant, id) DO
     UPDATE
     SET
         metric_type = excluded.metric_type,
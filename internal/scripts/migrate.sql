@@ -0,0 +1,8 @@
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS tenant VARCHAR(256) NOT NULL DEFAULT '';
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'metric_id_pk') THEN
+        ALTER TABLE metrics DROP CONSTRAINT metric_id_pk;
+        ALTER TABLE metrics ADD CONSTRAINT metric_tenant_id_pk PRIMARY KEY (tenant, id);
+    END IF;
+END $$;
\ No newline at end of file
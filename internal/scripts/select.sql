@@ -1 +1 @@
-SELECT id, metric_type, counter_value, gauge_value, hash FROM metrics;
\ No newline at end of file
+SELECT tenant, id, metric_type, counter_value, gauge_value, hash FROM metrics;
\ No newline at end of file
@@ -0,0 +1,124 @@
+package statsd
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/syols/go-devops/internal/models"
+)
+
+// Timer summary percentiles, reported as name_p50, name_p90...
+var percentiles = []float64{50, 90, 95, 99}
+
+// Aggregator accumulates samples between flushes like StatsD daemon.
+// Counters are summed, gauges keep the last value between flushes, timers are summarized and sets are counted
+type Aggregator struct {
+	counters map[string]float64
+	gauges   map[string]float64
+	updated  map[string]bool
+	timers   map[string][]float64
+	counts   map[string]float64
+	sets     map[string]map[string]bool
+	mutex    sync.Mutex
+}
+
+// NewAggregator creates aggregator struct
+func NewAggregator() *Aggregator {
+	aggregator := Aggregator{gauges: map[string]float64{}}
+	aggregator.reset()
+	return &aggregator
+}
+
+// Add sample to the current flush interval
+func (a *Aggregator) Add(sample Sample) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	switch sample.Type {
+	case CounterType:
+		a.counters[sample.Name] += sample.Value / sample.Rate
+	case GaugeType:
+		if sample.Relative {
+			a.gauges[sample.Name] += sample.Value
+		} else {
+			a.gauges[sample.Name] = sample.Value
+		}
+		a.updated[sample.Name] = true
+	case TimerType, HistogramType:
+		a.timers[sample.Name] = append(a.timers[sample.Name], sample.Value)
+		a.counts[sample.Name] += 1 / sample.Rate
+	case SetType:
+		if a.sets[sample.Name] == nil {
+			a.sets[sample.Name] = map[string]bool{}
+		}
+		a.sets[sample.Name][sample.Member] = true
+	}
+}
+
+// Flush returns metrics of the current flush interval and starts the next one
+func (a *Aggregator) Flush() []models.Metric {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	var result []models.Metric
+	for name, value := range a.counters {
+		if delta := math.Round(value); delta > 0 {
+			result = append(result, models.Counter(name, uint64(delta)))
+		}
+	}
+
+	for name := range a.updated {
+		result = append(result, models.Gauge(name, a.gauges[name]))
+	}
+
+	for name, values := range a.timers {
+		result = append(result, summary(name, values, a.counts[name])...)
+	}
+
+	for name, members := range a.sets {
+		result = append(result, models.Gauge(name, float64(len(members))))
+	}
+
+	a.reset()
+	return result
+}
+
+func (a *Aggregator) reset() {
+	a.counters = map[string]float64{}
+	a.updated = map[string]bool{}
+	a.timers = map[string][]float64{}
+	a.counts = map[string]float64{}
+	a.sets = map[string]map[string]bool{}
+}
+
+func summary(name string, values []float64, count float64) []models.Metric {
+	sort.Float64s(values)
+	sum := 0.0
+	for _, value := range values {
+		sum += value
+	}
+
+	result := []models.Metric{
+		models.Counter(name+"_count", uint64(math.Round(count))),
+		models.Gauge(name+"_min", values[0]),
+		models.Gauge(name+"_max", values[len(values)-1]),
+		models.Gauge(name+"_mean", sum/float64(len(values))),
+		models.Gauge(name+"_sum", sum),
+	}
+
+	for _, percentile := range percentiles {
+		result = append(result, models.Gauge(fmt.Sprintf("%s_p%.0f", name, percentile), rank(values, percentile)))
+	}
+	return result
+}
+
+// rank returns nearest-rank percentile of sorted values
+func rank(values []float64, percentile float64) float64 {
+	index := int(math.Ceil(percentile/100*float64(len(values)))) - 1
+	if index < 0 {
+		index = 0
+	}
+	return values[index]
+}
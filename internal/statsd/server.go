@@ -0,0 +1,114 @@
+package statsd
+
+import (
+	"context"
+	"log"
+	"net"
+	"time"
+
+	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/models"
+)
+
+const (
+	defaultFlushInterval = 10 * time.Second
+	maxPacketSize        = 65535
+)
+
+// Apply stores flushed metric
+type Apply func(metric models.Metric) error
+
+// Server receives StatsD lines over UDP and applies aggregated metrics every flush interval
+type Server struct {
+	address       string
+	flushInterval time.Duration
+	aggregator    *Aggregator
+	apply         Apply
+}
+
+// NewServer creates StatsD server struct
+func NewServer(settings config.StatsdConfig, apply Apply) *Server {
+	flushInterval := settings.FlushInterval
+	if flushInterval <= 0 {
+		flushInterval = defaultFlushInterval
+	}
+
+	address := ""
+	if settings.Address != nil {
+		address = *settings.Address
+	}
+
+	return &Server{
+		address:       address,
+		flushInterval: flushInterval,
+		aggregator:    NewAggregator(),
+		apply:         apply,
+	}
+}
+
+// Run listens UDP address until context is done, samples of the last interval are flushed on exit
+func (s *Server) Run(ctx context.Context) error {
+	conn, err := net.ListenPacket("udp", s.address)
+	if err != nil {
+		return err
+	}
+	log.Printf("StatsD listening %s", conn.LocalAddr().String())
+
+	go s.flushLoop(ctx)
+	go func() {
+		<-ctx.Done()
+		if err := conn.Close(); err != nil {
+			log.Print(err)
+		}
+	}()
+
+	buffer := make([]byte, maxPacketSize)
+	for {
+		n, _, err := conn.ReadFrom(buffer)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		s.Receive(buffer[:n])
+	}
+}
+
+// Receive adds StatsD lines of packet to the current flush interval, invalid lines are logged and skipped
+func (s *Server) Receive(packet []byte) {
+	samples, errs := ParseLines(packet)
+	for _, err := range errs {
+		log.Print(err)
+	}
+
+	for _, sample := range samples {
+		if sample.Type == CounterType && sample.Value < 0 {
+			log.Printf("%s: negative counter", sample.Name)
+			continue
+		}
+		s.aggregator.Add(sample)
+	}
+}
+
+// Flush applies metrics of the current flush interval
+func (s *Server) Flush() {
+	for _, metric := range s.aggregator.Flush() {
+		if err := s.apply(metric); err != nil {
+			log.Printf("%s: %s", metric.Name, err.Error())
+		}
+	}
+}
+
+func (s *Server) flushLoop(ctx context.Context) {
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.Flush()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
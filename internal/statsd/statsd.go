@@ -0,0 +1,111 @@
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/syols/go-devops/internal/models"
+)
+
+// StatsD metric types
+const (
+	GaugeType     = "g"
+	CounterType   = "c"
+	TimerType     = "ms"
+	HistogramType = "h"
+	SetType       = "s"
+)
+
+// Sample parsed StatsD line
+type Sample struct {
+	Name     string
+	Type     string
+	Value    float64
+	Member   string
+	Relative bool
+	Rate     float64
+}
+
+// ParseLines parses newline separated StatsD lines, invalid lines are returned as errors
+func ParseLines(payload []byte) ([]Sample, []error) {
+	var samples []Sample
+	var errs []error
+	for _, line := range strings.Split(string(payload), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		sample, err := Parse(line)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%q: %w", line, err))
+			continue
+		}
+		samples = append(samples, sample)
+	}
+	return samples, errs
+}
+
+// Parse StatsD line name:value|type|@rate|#tags, tags are ignored
+func Parse(line string) (Sample, error) {
+	pipe := strings.Index(line, "|")
+	if pipe < 0 {
+		return Sample{}, errors.New("no metric type")
+	}
+
+	colon := strings.LastIndex(line[:pipe], ":")
+	if colon <= 0 {
+		return Sample{}, errors.New("no metric name")
+	}
+
+	sample := Sample{Name: line[:colon], Rate: 1}
+	parts := strings.Split(line[colon+1:], "|")
+
+	sample.Type = parts[1]
+	for _, part := range parts[2:] {
+		if strings.HasPrefix(part, "@") {
+			rate, err := strconv.ParseFloat(part[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return Sample{}, fmt.Errorf("wrong sample rate %q", part)
+			}
+			sample.Rate = rate
+		}
+	}
+
+	value := parts[0]
+	switch sample.Type {
+	case SetType:
+		sample.Member = value
+		return sample, nil
+	case GaugeType:
+		sample.Relative = strings.HasPrefix(value, "+") || strings.HasPrefix(value, "-")
+	case CounterType, TimerType, HistogramType:
+	default:
+		return Sample{}, fmt.Errorf("unknown metric type %q", sample.Type)
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+		return Sample{}, fmt.Errorf("wrong value %q", value)
+	}
+	sample.Value = parsed
+	return sample, nil
+}
+
+// Metric converts absolute gauge or counter sample to metric, counter is scaled by sample rate
+func (s Sample) Metric() (models.Metric, error) {
+	switch {
+	case s.Type == GaugeType && !s.Relative:
+		return models.Gauge(s.Name, s.Value), nil
+	case s.Type == CounterType:
+		scaled := math.Round(s.Value / s.Rate)
+		if scaled < 0 {
+			return models.Metric{}, errors.New("negative counter")
+		}
+		return models.Counter(s.Name, uint64(scaled)), nil
+	}
+	return models.Metric{}, fmt.Errorf("%s sample of %s can not be converted to metric", s.Type, s.Name)
+}
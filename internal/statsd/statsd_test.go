@@ -0,0 +1,113 @@
+package statsd
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/models"
+	"github.com/syols/go-devops/internal/testutil"
+)
+
+func TestParse(t *testing.T) {
+	samples, errs := ParseLines([]byte("requests:2|c|@0.5\nload:1.5|g\nlatency:320|ms|#route:api\nusers:alice|s\nqueue:-2|g\nbroken\n"))
+	assert.Len(t, errs, 1)
+	require.Len(t, samples, 5)
+
+	assert.Equal(t, Sample{Name: "requests", Type: CounterType, Value: 2, Rate: 0.5}, samples[0])
+	assert.Equal(t, Sample{Name: "latency", Type: TimerType, Value: 320, Rate: 1}, samples[2])
+	assert.Equal(t, "alice", samples[3].Member)
+	assert.True(t, samples[4].Relative)
+
+	metric, err := samples[0].Metric()
+	require.NoError(t, err)
+	assert.Equal(t, models.CounterName, metric.MetricType)
+	assert.Equal(t, uint64(4), *metric.CounterValue)
+
+	_, err = samples[4].Metric()
+	assert.Error(t, err, "relative gauge")
+
+	for _, line := range []string{"name:1|x", "name:abc|g", "name:1|c|@2", ":1|g"} {
+		_, err := Parse(line)
+		assert.Error(t, err, line)
+	}
+}
+
+func TestAggregator(t *testing.T) {
+	aggregator := NewAggregator()
+	samples, errs := ParseLines([]byte("jobs:1|c\njobs:2|c|@0.5\nqueue:10|g\nqueue:-3|g\n" +
+		"latency:10|ms\nlatency:30|ms|@0.5\nlatency:20|ms\nusers:alice|s\nusers:bob|s\nusers:alice|s\n"))
+	require.Empty(t, errs)
+	for _, sample := range samples {
+		aggregator.Add(sample)
+	}
+
+	metrics := byName(aggregator.Flush())
+	assert.Equal(t, uint64(5), *metrics["jobs"].CounterValue)
+	assert.Equal(t, 7.0, *metrics["queue"].GaugeValue)
+	assert.Equal(t, 2.0, *metrics["users"].GaugeValue)
+	assert.Equal(t, uint64(4), *metrics["latency_count"].CounterValue)
+	assert.Equal(t, 10.0, *metrics["latency_min"].GaugeValue)
+	assert.Equal(t, 30.0, *metrics["latency_max"].GaugeValue)
+	assert.Equal(t, 20.0, *metrics["latency_mean"].GaugeValue)
+	assert.Equal(t, 60.0, *metrics["latency_sum"].GaugeValue)
+	assert.Equal(t, 20.0, *metrics["latency_p50"].GaugeValue)
+	assert.Equal(t, 30.0, *metrics["latency_p95"].GaugeValue)
+
+	assert.Empty(t, aggregator.Flush(), "interval without samples")
+
+	aggregator.Add(Sample{Name: "queue", Type: GaugeType, Value: 2, Relative: true, Rate: 1})
+	metrics = byName(aggregator.Flush())
+	assert.Equal(t, 9.0, *metrics["queue"].GaugeValue, "relative gauge keeps value between flushes")
+}
+
+func TestServer(t *testing.T) {
+	var mutex sync.Mutex
+	applied := map[string]models.Metric{}
+	apply := func(metric models.Metric) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		applied[metric.Name] = metric
+		return nil
+	}
+
+	address := testutil.FreeUDPAddress(t)
+	server := NewServer(config.StatsdConfig{Address: &address, FlushInterval: time.Hour}, apply)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- server.Run(ctx)
+	}()
+
+	conn, err := net.Dial("udp", address)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	assert.Eventually(t, func() bool {
+		_, err := conn.Write([]byte("requests:1|c\nrequests:-1|c\n"))
+		require.NoError(t, err)
+		server.Flush()
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		_, isOk := applied["requests"]
+		return isOk
+	}, 5*time.Second, 50*time.Millisecond)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func byName(metrics []models.Metric) map[string]models.Metric {
+	result := map[string]models.Metric{}
+	for _, metric := range metrics {
+		result[metric.Name] = metric
+	}
+	return result
+}
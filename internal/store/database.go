@@ -26,14 +26,18 @@ func NewDatabaseStore(connectionString string) (DatabaseStore, error) {
 		return DatabaseStore{}, err
 	}
 
-	if _, err := db.Exec(loadSQL("create.sql")); err != nil {
+	if _, err := db.Exec(LoadSQL("create.sql")); err != nil {
+		log.Print(err)
+	}
+
+	if _, err := db.Exec(LoadSQL("migrate.sql")); err != nil {
 		log.Print(err)
 	}
 
 	return DatabaseStore{
 		dataSourceName: connectionString,
-		selectQuery:    loadSQL("select.sql"),
-		insertQuery:    loadSQL("insert.sql"),
+		selectQuery:    LoadSQL("select.sql"),
+		insertQuery:    LoadSQL("insert.sql"),
 	}, nil
 }
 
@@ -99,7 +103,8 @@ func (d DatabaseStore) Type() string {
 	return "database"
 }
 
-func loadSQL(file string) string {
+// LoadSQL loads SQL script from scripts directory
+func LoadSQL(file string) string {
 	path := filepath.Join("internal", "scripts", file)
 
 	c, err := os.ReadFile(path)
@@ -3,6 +3,7 @@ package store
 import (
 	"context"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/syols/go-devops/config"
@@ -20,12 +21,17 @@ type Store interface {
 // Metrics struct
 type Metrics map[string]models.Metric
 
-// MetricsStorage struct
+// Hook is called on every accepted metric update
+type Hook func(previous *models.Metric, current models.Metric)
+
+// MetricsStorage struct, Metrics are guarded by mutex shared by storage copies
 type MetricsStorage struct {
 	Store
 	Metrics
 	Key          *string
 	SaveInterval time.Duration
+	hooks        []Hook
+	mutex        *sync.RWMutex
 }
 
 // NewStore creates
@@ -48,12 +54,8 @@ func NewMetricsStorage(settings config.Config) (MetricsStorage, error) {
 		return MetricsStorage{}, err
 	}
 
-	metrics := MetricsStorage{
-		Metrics:      make(Metrics),
-		Store:        store,
-		SaveInterval: settings.Store.StoreInterval,
-		Key:          settings.Server.Key,
-	}
+	metrics := NewMetrics(store, settings.Server.Key)
+	metrics.SaveInterval = settings.Store.StoreInterval
 
 	if settings.Store.Restore {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -75,30 +77,114 @@ func NewMetricsStorage(settings config.Config) (MetricsStorage, error) {
 	return metrics, nil
 }
 
+// NewMetrics creates storage of metrics kept in memory and saved to store
+func NewMetrics(store Store, key *string) MetricsStorage {
+	return MetricsStorage{
+		Metrics: make(Metrics),
+		Store:   store,
+		Key:     key,
+		mutex:   &sync.RWMutex{},
+	}
+}
+
 // Load metrics from storage
 func (m MetricsStorage) Load(ctx context.Context) {
 	if metricsPayload, err := m.Store.Load(ctx); err == nil {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
 		for _, payload := range metricsPayload {
-			m.Metrics[payload.Name] = payload
+			m.Metrics[payload.Key()] = payload
 		}
 	}
 }
 
 // Save metrics to storage
 func (m MetricsStorage) Save(ctx context.Context) error {
-	length := len(m.Metrics)
-	if length == 0 {
-		return nil
-	}
-
 	var result []models.Metric
-	for _, v := range m.Metrics {
+	for _, v := range m.List() {
+		if v.Derived {
+			continue
+		}
 		result = append(result, v)
 	}
 
+	if len(result) == 0 {
+		return nil
+	}
 	return m.Store.Save(ctx, result)
 }
 
+// AddHook registers hook called on accepted updates
+func (m *MetricsStorage) AddHook(hook Hook) {
+	m.hooks = append(m.hooks, hook)
+}
+
+// Set metric to storage and call registered hooks, hooks are called without lock and can use storage
+func (m MetricsStorage) Set(metric models.Metric) {
+	m.mutex.Lock()
+	previous, isOk := m.Metrics[metric.Key()]
+	m.Metrics[metric.Key()] = metric
+	m.mutex.Unlock()
+
+	for _, hook := range m.hooks {
+		if isOk {
+			hook(&previous, metric)
+			continue
+		}
+		hook(nil, metric)
+	}
+}
+
+// Update metric of tenant namespace atomically, update calculates stored metric from the previous one.
+// Registered hooks are called when update succeeds
+func (m MetricsStorage) Update(tenant, name string, update func(previous *models.Metric) (models.Metric, error)) error {
+	m.mutex.Lock()
+	var previous *models.Metric
+	if stored, isOk := m.Metrics[models.Key(tenant, name)]; isOk {
+		previous = &stored
+	}
+
+	metric, err := update(previous)
+	if err != nil {
+		m.mutex.Unlock()
+		return err
+	}
+	m.Metrics[metric.Key()] = metric
+	m.mutex.Unlock()
+
+	for _, hook := range m.hooks {
+		hook(previous, metric)
+	}
+	return nil
+}
+
+// Put metric to storage without calling hooks
+func (m MetricsStorage) Put(metric models.Metric) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.Metrics[metric.Key()] = metric
+}
+
+// Get metric by name from tenant namespace
+func (m MetricsStorage) Get(tenant, name string) (models.Metric, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	metric, isOk := m.Metrics[models.Key(tenant, name)]
+	return metric, isOk
+}
+
+// List snapshot of stored metrics
+func (m MetricsStorage) List() []models.Metric {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	result := make([]models.Metric, 0, len(m.Metrics))
+	for _, metric := range m.Metrics {
+		result = append(result, metric)
+	}
+	return result
+}
+
 // Check store
 func (m MetricsStorage) Check() error {
 	return m.Store.Check()
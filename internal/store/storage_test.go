@@ -2,10 +2,12 @@ package store
 
 import (
 	"context"
+	"sync"
 	"testing"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/syols/go-devops/config"
 	"github.com/syols/go-devops/internal/models"
@@ -48,10 +50,7 @@ func TestLoadStorage(t *testing.T) {
 
 	store := mock_store.NewMockStore(ctrl)
 	store.EXPECT().Load(ctx).AnyTimes()
-	metrics := MetricsStorage{
-		Metrics: make(Metrics),
-		Store:   store,
-	}
+	metrics := NewMetrics(store, nil)
 	metrics.Load(ctx)
 }
 
@@ -61,3 +60,29 @@ func TestSaveStorage(t *testing.T) {
 	err := store.Save(ctx, metrics)
 	assert.NoError(t, err)
 }
+
+func TestUpdateConcurrent(t *testing.T) {
+	metrics := NewMetrics(nil, nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				err := metrics.Update("", "PollCount", func(previous *models.Metric) (models.Metric, error) {
+					metric := models.Counter("PollCount", 1)
+					if previous != nil {
+						*metric.CounterValue += *previous.CounterValue
+					}
+					return metric, nil
+				})
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	metric, isOk := metrics.Get("", "PollCount")
+	require.True(t, isOk)
+	assert.Equal(t, uint64(5000), *metric.CounterValue)
+}
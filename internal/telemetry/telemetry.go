@@ -0,0 +1,260 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/models"
+)
+
+// Name of agent telemetry collector
+const Name = "agent"
+
+// Agent metric names
+const (
+	SendSuccess     = "AgentSendSuccess"
+	SendFailures    = "AgentSendFailures"
+	SendLatency     = "AgentSendLatency"
+	QueueDepth      = "AgentQueueDepth"
+	BatchSize       = "AgentBatchSize"
+	CollectDuration = "AgentCollectDuration"
+	DroppedMetrics  = "AgentDroppedMetrics"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+// Latency histogram bucket upper bounds, reported as name_le_<milliseconds> and name_le_inf
+var latencyBuckets = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+}
+
+// Telemetry agent self metrics. Published with host metrics as "agent" collector and served by health endpoints
+type Telemetry struct {
+	counters    map[string]uint64
+	totals      map[string]uint64
+	gauges      map[string]float64
+	funcs       map[string]func() float64
+	address     *string
+	staleAfter  time.Duration
+	started     time.Time
+	lastSuccess time.Time
+	now         func() time.Time
+	mutex       sync.Mutex
+}
+
+// NewTelemetry creates telemetry struct, agent is stale after three report intervals without successful send by default
+func NewTelemetry(settings config.AgentConfig) *Telemetry {
+	staleAfter := settings.Telemetry.StaleAfter
+	if staleAfter <= 0 {
+		staleAfter = 3 * settings.ReportInterval
+	}
+
+	return &Telemetry{
+		counters:   map[string]uint64{},
+		totals:     map[string]uint64{},
+		gauges:     map[string]float64{},
+		funcs:      map[string]func() float64{},
+		address:    settings.Telemetry.Address,
+		staleAfter: staleAfter,
+		started:    time.Now(),
+		now:        time.Now,
+	}
+}
+
+// Add counter delta
+func (t *Telemetry) Add(name string, delta uint64) {
+	if delta == 0 {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.counters[name] += delta
+	t.totals[name] += delta
+}
+
+// Set gauge value
+func (t *Telemetry) Set(name string, value float64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.gauges[name] = value
+}
+
+// GaugeFunc registers gauge read on every collection
+func (t *Telemetry) GaugeFunc(name string, value func() float64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.funcs[name] = value
+}
+
+// Observe duration in cumulative histogram buckets, sum is counted in milliseconds
+func (t *Telemetry) Observe(name string, duration time.Duration) {
+	t.Add(name+"_sum_ms", uint64(duration.Milliseconds()))
+	for _, bucket := range latencyBuckets {
+		if duration <= bucket {
+			t.Add(name+"_le_"+strconv.FormatInt(bucket.Milliseconds(), 10), 1)
+		}
+	}
+	t.Add(name+"_le_inf", 1)
+}
+
+// Succeeded marks successful send
+func (t *Telemetry) Succeeded() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.lastSuccess = t.now()
+}
+
+// Collect counter deltas since the last collection and current gauges
+func (t *Telemetry) Collect(context.Context) ([]models.Metric, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	result := make([]models.Metric, 0, len(t.counters)+len(t.gauges)+len(t.funcs))
+	for name, delta := range t.counters {
+		result = append(result, models.Counter(name, delta))
+	}
+	t.counters = map[string]uint64{}
+
+	for name, value := range t.values() {
+		result = append(result, models.Gauge(name, value))
+	}
+	return result, nil
+}
+
+// String JSON of counter totals and gauges, implements expvar.Var
+func (t *Telemetry) String() string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	vars := map[string]interface{}{}
+	for name, total := range t.totals {
+		vars[name] = total
+	}
+	for name, value := range t.values() {
+		vars[name] = value
+	}
+
+	content, err := json.Marshal(vars)
+	if err != nil {
+		return "{}"
+	}
+	return string(content)
+}
+
+// Health status of agent, agent is healthy while metrics are delivered
+type Health struct {
+	Status      string     `json:"status"`
+	Uptime      string     `json:"uptime"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+}
+
+// Health returns agent health, agent without successful send is healthy during stale period after start
+func (t *Telemetry) Health() (Health, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := t.now()
+	health := Health{Status: "ok", Uptime: now.Sub(t.started).Round(time.Second).String()}
+	since := t.started
+	if !t.lastSuccess.IsZero() {
+		lastSuccess := t.lastSuccess
+		health.LastSuccess = &lastSuccess
+		since = lastSuccess
+	}
+
+	if now.Sub(since) > t.staleAfter {
+		health.Status = "stale"
+		return health, false
+	}
+	return health, true
+}
+
+// Run serves /healthz and /debug/vars until context is done, endpoints are disabled without address
+func (t *Telemetry) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	if t.address == nil {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", t.HealthHandler)
+	mux.HandleFunc("/debug/vars", t.VarsHandler)
+	server := http.Server{Addr: *t.address, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Print(err)
+		}
+	}()
+
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Print(err)
+	}
+}
+
+// HealthHandler responds with health status, 503 when agent is stale
+func (t *Telemetry) HealthHandler(w http.ResponseWriter, _ *http.Request) {
+	health, healthy := t.Health()
+	w.Header().Set("Content-Type", "application/json")
+	if !healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	if err := json.NewEncoder(w).Encode(health); err != nil {
+		log.Print(err)
+	}
+}
+
+// VarsHandler responds with published expvar variables and agent telemetry
+func (t *Telemetry) VarsHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	var vars []expvar.KeyValue
+	expvar.Do(func(kv expvar.KeyValue) {
+		vars = append(vars, kv)
+	})
+	vars = append(vars, expvar.KeyValue{Key: Name, Value: t})
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Key < vars[j].Key })
+
+	fmt.Fprint(w, "{\n")
+	for i, kv := range vars {
+		if i > 0 {
+			fmt.Fprint(w, ",\n")
+		}
+		fmt.Fprintf(w, "%q: %s", kv.Key, kv.Value)
+	}
+	fmt.Fprint(w, "\n}\n")
+}
+
+// values of gauges including gauge funcs, caller holds mutex
+func (t *Telemetry) values() map[string]float64 {
+	result := make(map[string]float64, len(t.gauges)+len(t.funcs))
+	for name, value := range t.gauges {
+		result[name] = value
+	}
+	for name, value := range t.funcs {
+		result[name] = value()
+	}
+	return result
+}
@@ -0,0 +1,73 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/syols/go-devops/config"
+	"github.com/syols/go-devops/internal/models"
+)
+
+func TestCollect(t *testing.T) {
+	telemetry := NewTelemetry(config.AgentConfig{ReportInterval: time.Second})
+	depth := 3
+	telemetry.GaugeFunc(QueueDepth, func() float64 { return float64(depth) })
+	telemetry.Add(SendSuccess, 2)
+	telemetry.Set(BatchSize, 10)
+	telemetry.Observe(SendLatency, 30*time.Millisecond)
+
+	metrics, err := telemetry.Collect(context.Background())
+	require.NoError(t, err)
+	collected := models.Values(metrics)
+	assert.Equal(t, 2.0, collected[SendSuccess])
+	assert.Equal(t, 10.0, collected[BatchSize])
+	assert.Equal(t, 3.0, collected[QueueDepth])
+	assert.Equal(t, 30.0, collected[SendLatency+"_sum_ms"])
+	assert.Equal(t, 1.0, collected[SendLatency+"_le_50"])
+	assert.Equal(t, 1.0, collected[SendLatency+"_le_inf"])
+	assert.NotContains(t, collected, SendLatency+"_le_25")
+
+	depth = 0
+	metrics, err = telemetry.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{BatchSize: 10, QueueDepth: 0}, models.Values(metrics), "counters are deltas")
+
+	var vars map[string]float64
+	require.NoError(t, json.Unmarshal([]byte(telemetry.String()), &vars))
+	assert.Equal(t, 2.0, vars[SendSuccess], "vars keep totals")
+}
+
+func TestHealth(t *testing.T) {
+	telemetry := NewTelemetry(config.AgentConfig{ReportInterval: time.Second})
+	now := telemetry.started
+	telemetry.now = func() time.Time { return now }
+
+	recorder := httptest.NewRecorder()
+	telemetry.HealthHandler(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code, "starting agent")
+
+	now = now.Add(5 * time.Second)
+	recorder = httptest.NewRecorder()
+	telemetry.HealthHandler(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+	telemetry.Succeeded()
+	health, healthy := telemetry.Health()
+	assert.True(t, healthy)
+	assert.Equal(t, "ok", health.Status)
+	require.NotNil(t, health.LastSuccess)
+
+	recorder = httptest.NewRecorder()
+	telemetry.VarsHandler(recorder, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+	var vars map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &vars))
+	assert.Contains(t, vars, Name)
+	assert.Contains(t, vars, "memstats")
+}